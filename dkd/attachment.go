@@ -0,0 +1,165 @@
+/* license: https://mit-license.org
+ *
+ *  Dao-Ke-Dao: Universal Message Module
+ *
+ *                                Written in 2022 by Moky <albert.moky@gmail.com>
+ *
+ * ==============================================================================
+ * The MIT License (MIT)
+ *
+ * Copyright (c) 2022 Albert Moky
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ * ==============================================================================
+ */
+package dkd
+
+import (
+	"sync"
+	. "github.com/dimchat/dkd-go/protocol"
+	. "github.com/dimchat/mkm-go/protocol"
+)
+
+/**
+ *  Attachment Data Source
+ *  ~~~~~~~~~~~~~~~~~~~~~~
+ */
+type AttachmentDataSource interface {
+	GetMeta(identifier ID) Meta
+	GetVisa(identifier ID) Visa
+}
+
+/**
+ *  First Contact Policy
+ *  ~~~~~~~~~~~~~~~~~~~~
+ *  Attach sender's meta & visa to the first N messages for each receiver,
+ *  and to every message for stations.
+ */
+type FirstContactPolicy struct {
+
+	_dataSource AttachmentDataSource
+	_limit int
+
+	_counts map[string]int
+	_lock sync.Mutex
+}
+
+func NewFirstContactPolicy(dataSource AttachmentDataSource, limit int) *FirstContactPolicy {
+	policy := new(FirstContactPolicy)
+	policy.Init(dataSource, limit)
+	return policy
+}
+
+func (policy *FirstContactPolicy) Init(dataSource AttachmentDataSource, limit int) AttachmentPolicy {
+	policy._dataSource = dataSource
+	policy._limit = limit
+	policy._counts = make(map[string]int)
+	return policy
+}
+
+/**
+ *  Forget the receiver, e.g.: its session was reset
+ */
+func (policy *FirstContactPolicy) Reset(receiver ID) {
+	policy._lock.Lock()
+	defer policy._lock.Unlock()
+	delete(policy._counts, receiver.String())
+}
+
+//-------- IAttachmentPolicy
+
+func (policy *FirstContactPolicy) Attach(rMsg ReliableMessage) {
+	receiver := rMsg.Receiver()
+	if receiver.Type() != STATION {
+		policy._lock.Lock()
+		count := policy._counts[receiver.String()]
+		if count >= policy._limit {
+			policy._lock.Unlock()
+			return
+		}
+		policy._counts[receiver.String()] = count + 1
+		policy._lock.Unlock()
+	}
+	sender := rMsg.Sender()
+	if meta := policy._dataSource.GetMeta(sender); meta != nil {
+		rMsg.SetMeta(meta)
+	}
+	if visa := policy._dataSource.GetVisa(sender); visa != nil {
+		rMsg.SetVisa(visa)
+	}
+}
+
+/**
+ *  Strict Handshake Policy
+ *  ~~~~~~~~~~~~~~~~~~~~~~~
+ *  Accept attached meta only if it's valid (fingerprint signed by its key)
+ *  and matches the sender ID; accept attached visa only if it's for the
+ *  sender and signed by the sender's meta key (attached or local).
+ *  Both are rejected when larger than maxSize (bytes of JsON, 0 for no limit).
+ */
+type StrictHandshakePolicy struct {
+
+	_dataSource AttachmentDataSource  // for local meta
+	_maxSize int
+}
+
+func NewStrictHandshakePolicy(dataSource AttachmentDataSource, maxSize int) *StrictHandshakePolicy {
+	policy := new(StrictHandshakePolicy)
+	policy.Init(dataSource, maxSize)
+	return policy
+}
+
+func (policy *StrictHandshakePolicy) Init(dataSource AttachmentDataSource, maxSize int) HandshakePolicy {
+	policy._dataSource = dataSource
+	policy._maxSize = maxSize
+	return policy
+}
+
+//-------- IHandshakePolicy
+
+func (policy *StrictHandshakePolicy) AcceptMeta(meta Meta, rMsg ReliableMessage) bool {
+	if !policy.checkSize(meta.Map()) {
+		return false
+	}
+	return MetaCheck(meta) && MetaMatchID(meta, rMsg.Sender())
+}
+
+func (policy *StrictHandshakePolicy) AcceptVisa(visa Visa, rMsg ReliableMessage) bool {
+	if !policy.checkSize(visa.Map()) {
+		return false
+	}
+	sender := rMsg.Sender()
+	if !sender.Equal(visa.ID()) {
+		return false
+	}
+	// attached meta first (checked by AcceptMeta), then the local one
+	meta := rMsg.Meta()
+	if meta == nil && policy._dataSource != nil {
+		meta = policy._dataSource.GetMeta(sender)
+	}
+	return meta != nil && visa.Verify(meta.Key())
+}
+
+func (policy *StrictHandshakePolicy) checkSize(info map[string]interface{}) bool {
+	if policy._maxSize <= 0 {
+		return true
+	}
+	blob, err := CanonicalJSON(info)
+	return err == nil && len(blob) <= policy._maxSize
+}
@@ -0,0 +1,88 @@
+/* license: https://mit-license.org
+ *
+ *  Dao-Ke-Dao: Universal Message Module
+ *
+ *                                Written in 2022 by Moky <albert.moky@gmail.com>
+ *
+ * ==============================================================================
+ * The MIT License (MIT)
+ *
+ * Copyright (c) 2022 Albert Moky
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ * ==============================================================================
+ */
+package dkd
+
+import (
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+	. "github.com/dimchat/mkm-go/digest"
+	. "github.com/dimchat/mkm-go/protocol"
+)
+
+/**
+ *  Audit Log
+ *  ~~~~~~~~~
+ *  Records every signature verification in a hash-chained log,
+ *  so the entries cannot be removed or altered without breaking the chain.
+ *
+ *  build with: go build -tags audit
+ *
+ *  line format: "{time} {sender} {signature} {ok} {duration} {prev} {hash}"
+ *      signature = hex(sha256(signature))[:16], to find the forged copies
+ *      hash      = sha256(prev + "{time} {sender} {signature} {ok} {duration}")
+ */
+var auditWriter io.Writer = os.Stderr
+var auditHash = make([]byte, 32)  // genesis
+var auditLock sync.Mutex
+
+func AuditSetWriter(writer io.Writer) {
+	auditLock.Lock()
+	defer auditLock.Unlock()
+	auditWriter = writer
+}
+
+func auditVerify(sender ID, signature []byte, ok bool, elapsed time.Duration) {
+	fingerprint := hex.EncodeToString(SHA256(signature))[:16]
+	auditLock.Lock()
+	defer auditLock.Unlock()
+	entry := fmt.Sprintf("%d %s %s %t %d", time.Now().UnixNano(), sender, fingerprint, ok, elapsed.Nanoseconds())
+	prev := hex.EncodeToString(auditHash)
+	auditHash = SHA256([]byte(prev + entry))
+	_, _ = fmt.Fprintf(auditWriter, "%s %s %s\n", entry, prev, hex.EncodeToString(auditHash))
+}
+
+/**
+ *  Compare signatures (or digests) in constant time,
+ *  for delegates verifying by recomputing the signature (e.g.: HMAC),
+ *  so the time taken doesn't leak how many leading bytes matched
+ *
+ * @param expected - recomputed signature
+ * @param actual   - signature in message
+ * @return true on equal
+ */
+func SignatureEqual(expected []byte, actual []byte) bool {
+	return subtle.ConstantTimeCompare(expected, actual) == 1
+}
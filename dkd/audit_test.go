@@ -0,0 +1,66 @@
+//go:build audit
+// +build audit
+
+/* license: https://mit-license.org
+ *
+ *  Dao-Ke-Dao: Universal Message Module
+ *
+ *                                Written in 2022 by Moky <albert.moky@gmail.com>
+ *
+ * ==============================================================================
+ * The MIT License (MIT)
+ *
+ * Copyright (c) 2022 Albert Moky
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ * ==============================================================================
+ */
+package dkd_test
+
+import (
+	"bytes"
+	"encoding/base64"
+	"os"
+	"strings"
+	"testing"
+	. "github.com/dimchat/dkd-go/dkd"
+	. "github.com/dimchat/dkd-go/protocol"
+	. "github.com/dimchat/mkm-go/types"
+)
+
+func TestAuditImplausibleSignature(t *testing.T) {
+	alice, bob := newPeer("alice@a1"), newPeer("bob@b1")
+	env := EnvelopeCreate(alice.ID(), bob.ID(), TimeNow())
+	iMsg := NewInstantMessage(nil, env, textContent("hello"))
+	iMsg.SetDelegate(alice)
+	info := iMsg.Encrypt(new(testCrypto).GenerateKey(), nil).Sign().CopyMap(false)
+	info["signature"] = base64.StdEncoding.EncodeToString([]byte("short"))
+	rMsg := ReliableMessageParse(info)
+	rMsg.SetDelegate(bob)
+
+	var log bytes.Buffer
+	AuditSetWriter(&log)
+	defer AuditSetWriter(os.Stderr)
+	if sMsg := rMsg.Verify(); sMsg != nil {
+		t.Fatal("implausible signature verified")
+	}
+	if fields := strings.Fields(log.String()); len(fields) != 7 || fields[3] != "false" {
+		t.Fatalf("implausible signature not audited: %q", log.String())
+	}
+}
@@ -0,0 +1,130 @@
+/* license: https://mit-license.org
+ *
+ *  Dao-Ke-Dao: Universal Message Module
+ *
+ *                                Written in 2022 by Moky <albert.moky@gmail.com>
+ *
+ * ==============================================================================
+ * The MIT License (MIT)
+ *
+ * Copyright (c) 2022 Albert Moky
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ * ==============================================================================
+ */
+package dkd_test
+
+import (
+	"testing"
+	"github.com/dimchat/dkd-go/dkd/sim"
+	. "github.com/dimchat/dkd-go/dkd"
+	. "github.com/dimchat/dkd-go/protocol"
+	. "github.com/dimchat/mkm-go/crypto"
+	. "github.com/dimchat/mkm-go/protocol"
+	. "github.com/dimchat/mkm-go/types"
+)
+
+type bufferedPeer struct {
+	*sim.Peer
+	calls map[string]int
+}
+
+func (peer *bufferedPeer) DecodeDataInto(buffer []byte, data interface{}, sMsg SecureMessage) []byte {
+	peer.calls["data"]++
+	return append(buffer, peer.DecodeData(data, sMsg)...)
+}
+
+func (peer *bufferedPeer) DecodeKeyInto(buffer []byte, key interface{}, sMsg SecureMessage) []byte {
+	peer.calls["key"]++
+	return append(buffer, peer.DecodeKey(key, sMsg)...)
+}
+
+func (peer *bufferedPeer) DecodeSignatureInto(buffer []byte, signature interface{}, rMsg ReliableMessage) []byte {
+	peer.calls["signature"]++
+	return append(buffer, peer.DecodeSignature(signature, rMsg)...)
+}
+
+func TestBufferedDecoder(t *testing.T) {
+	alice := newPeer("alice@a1")
+	bob := &bufferedPeer{newPeer("bob@b1"), make(map[string]int)}
+	env := EnvelopeCreate(alice.ID(), bob.ID(), TimeNow())
+	iMsg := NewInstantMessage(nil, env, textContent("hello"))
+	iMsg.SetDelegate(alice)
+	rMsg := iMsg.Encrypt(new(testCrypto).GenerateKey(), nil).Sign()
+	rMsg.SetDelegate(bob)
+
+	sMsg := rMsg.Verify()
+	if sMsg == nil {
+		t.Fatal("failed to verify")
+	}
+	decrypted := sMsg.Decrypt()
+	if decrypted == nil || decrypted.Content().Get("text") != "hello" {
+		t.Fatal("failed to decrypt")
+	}
+	if bob.calls["data"] != 2 || bob.calls["key"] != 1 || bob.calls["signature"] != 1 {
+		t.Fatalf("unexpected decode calls: %v", bob.calls)
+	}
+	// buffers released, decoded again from the map
+	if len(rMsg.Signature()) == 0 || bob.calls["signature"] != 2 {
+		t.Fatalf("signature not released after verify: %v", bob.calls)
+	}
+	rMsg.Wipe()
+}
+
+type capturingPeer struct {
+	*sim.Peer
+	plaintext [][]byte
+}
+
+func (peer *capturingPeer) DecryptKey(key []byte, sender ID, receiver ID, sMsg SecureMessage) []byte {
+	data := peer.Peer.DecryptKey(key, sender, receiver, sMsg)
+	peer.plaintext = append(peer.plaintext, data)
+	return data
+}
+
+func (peer *capturingPeer) DecryptContent(data []byte, password SymmetricKey, sMsg SecureMessage) []byte {
+	data = peer.Peer.DecryptContent(data, password, sMsg)
+	peer.plaintext = append(peer.plaintext, data)
+	return data
+}
+
+func TestDecryptWipesPlaintext(t *testing.T) {
+	alice := newPeer("alice@a1")
+	bob := &capturingPeer{Peer: newPeer("bob@b1")}
+	env := EnvelopeCreate(alice.ID(), bob.ID(), TimeNow())
+	iMsg := NewInstantMessage(nil, env, textContent("hello"))
+	iMsg.SetDelegate(alice)
+	sMsg := iMsg.Encrypt(new(testCrypto).GenerateKey(), nil)
+	sMsg.SetDelegate(bob)
+
+	decrypted := sMsg.Decrypt()
+	if decrypted == nil || decrypted.Content().Get("text") != "hello" {
+		t.Fatal("failed to decrypt")
+	}
+	if len(bob.plaintext) != 2 {
+		t.Fatalf("expected key and content decrypted, got %d", len(bob.plaintext))
+	}
+	for _, data := range bob.plaintext {
+		for _, b := range data {
+			if b != 0 {
+				t.Fatalf("plaintext not wiped: %q", data)
+			}
+		}
+	}
+}
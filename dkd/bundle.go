@@ -0,0 +1,213 @@
+/* license: https://mit-license.org
+ *
+ *  Dao-Ke-Dao: Universal Message Module
+ *
+ *                                Written in 2022 by Moky <albert.moky@gmail.com>
+ *
+ * ==============================================================================
+ * The MIT License (MIT)
+ *
+ * Copyright (c) 2022 Albert Moky
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ * ==============================================================================
+ */
+package dkd
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"hash"
+	"io"
+	. "github.com/dimchat/dkd-go/protocol"
+	. "github.com/dimchat/mkm-go/protocol"
+)
+
+var (
+	ErrBundleIndexMissing = errors.New("bundle index missing")
+	ErrBundleNotMatch     = errors.New("bundle digest or signature not match")
+)
+
+/**
+ *  Bundle Signer
+ *  ~~~~~~~~~~~~~
+ *  Signs/verifies the digest of a bundle with the station's key
+ */
+type BundleSigner interface {
+	SignBundle(digest []byte, sender ID) []byte
+	VerifyBundle(digest []byte, signature []byte, sender ID) bool
+}
+
+/**
+ *  Bundle Message
+ *  ~~~~~~~~~~~~~~
+ *  Container for station-to-station mirroring, packs many reliable messages
+ *  (each keeps its own end-to-end signature) with one signature for all:
+ *
+ *      {...message 1...}\n
+ *      {...message 2...}\n
+ *      ...
+ *      {"bundle_index": {sender, entries, digest, signature}}\n
+ *
+ *  digest = sha256(all message lines), so it can be packed/unpacked
+ *  in streaming without holding the messages in memory.
+ */
+type BundleIndex struct {
+	Sender    string        `json:"sender"`
+	Entries   []BundleEntry `json:"entries"`
+	Digest    string        `json:"digest"`     // hex
+	Signature string        `json:"signature"`  // base64
+}
+
+type BundleEntry struct {
+	Fingerprint string `json:"fp"`      // MessageFingerprint()
+	Offset      int64  `json:"offset"`  // position of the line in bundle
+	Length      int    `json:"length"`  // length of the line, without '\n'
+}
+
+type bundleTrailer struct {
+	Index *BundleIndex `json:"bundle_index"`
+}
+
+/**
+ *  Bundle Writer
+ *  ~~~~~~~~~~~~~
+ */
+type BundleWriter struct {
+	_writer io.Writer
+	_signer BundleSigner
+	_hash hash.Hash
+	_index BundleIndex
+	_offset int64
+	_sender ID
+}
+
+func NewBundleWriter(writer io.Writer, sender ID, signer BundleSigner) *BundleWriter {
+	bw := new(BundleWriter)
+	bw.Init(writer, sender, signer)
+	return bw
+}
+
+func (bw *BundleWriter) Init(writer io.Writer, sender ID, signer BundleSigner) *BundleWriter {
+	bw._writer = writer
+	bw._signer = signer
+	bw._hash = sha256.New()
+	bw._index = BundleIndex{Sender: sender.String(), Entries: make([]BundleEntry, 0)}
+	bw._offset = 0
+	bw._sender = sender
+	return bw
+}
+
+func (bw *BundleWriter) Add(rMsg ReliableMessage) error {
+	line, err := CanonicalJSON(rMsg.Map())
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+	if _, err = bw._writer.Write(line); err != nil {
+		return err
+	}
+	bw._hash.Write(line)
+	bw._index.Entries = append(bw._index.Entries, BundleEntry{
+		Fingerprint: MessageFingerprint(rMsg),
+		Offset: bw._offset,
+		Length: len(line) - 1,
+	})
+	bw._offset += int64(len(line))
+	return nil
+}
+
+/**
+ *  Sign and write the index, the writer can't be used after closed
+ */
+func (bw *BundleWriter) Close() error {
+	digest := bw._hash.Sum(nil)
+	bw._index.Digest = hex.EncodeToString(digest)
+	signature := bw._signer.SignBundle(digest, bw._sender)
+	bw._index.Signature = base64.StdEncoding.EncodeToString(signature)
+	line, err := json.Marshal(&bundleTrailer{Index: &bw._index})
+	if err != nil {
+		return err
+	}
+	_, err = bw._writer.Write(append(line, '\n'))
+	return err
+}
+
+/**
+ *  Unpack bundle in streaming
+ *
+ *  Messages are handed to the handler while reading, the bundle signature
+ *  can only be checked at the end, so the handler should keep them pending
+ *  until ReadBundle returns without error.
+ *
+ * @param reader  - bundle stream
+ * @param signer  - for verifying bundle signature
+ * @param handler - callback for each message
+ * @return bundle index
+ */
+func ReadBundle(reader io.Reader, signer BundleSigner, handler func(rMsg ReliableMessage)) (*BundleIndex, error) {
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 0, 64 * 1024), 16 * 1024 * 1024)
+	digester := sha256.New()
+	var index *BundleIndex
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if index != nil {
+			// nothing allowed after the index
+			return nil, ErrBundleNotMatch
+		}
+		var info map[string]interface{}
+		if err := json.Unmarshal(line, &info); err != nil {
+			return nil, err
+		}
+		if _, ok := info["bundle_index"]; ok {
+			var trailer bundleTrailer
+			if err := json.Unmarshal(line, &trailer); err != nil {
+				return nil, err
+			}
+			index = trailer.Index
+			continue
+		}
+		digester.Write(line)
+		digester.Write([]byte{'\n'})
+		rMsg := ReliableMessageParse(info)
+		if rMsg != nil {
+			handler(rMsg)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if index == nil {
+		return nil, ErrBundleIndexMissing
+	}
+	digest := digester.Sum(nil)
+	expected, _ := hex.DecodeString(index.Digest)
+	signature, err := base64.StdEncoding.DecodeString(index.Signature)
+	sender := IDParse(index.Sender)
+	if err != nil || sender == nil || !SignatureEqual(digest, expected) ||
+		!signer.VerifyBundle(digest, signature, sender) {
+		return index, ErrBundleNotMatch
+	}
+	return index, nil
+}
@@ -0,0 +1,225 @@
+/* license: https://mit-license.org
+ *
+ *  Dao-Ke-Dao: Universal Message Module
+ *
+ *                                Written in 2022 by Moky <albert.moky@gmail.com>
+ *
+ * ==============================================================================
+ * The MIT License (MIT)
+ *
+ * Copyright (c) 2022 Albert Moky
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ * ==============================================================================
+ */
+package dkd
+
+import (
+	"container/list"
+	"encoding/hex"
+	"sync"
+	"time"
+	. "github.com/dimchat/dkd-go/protocol"
+	. "github.com/dimchat/mkm-go/digest"
+)
+
+/**
+ *  Cache Metrics
+ *  ~~~~~~~~~~~~~
+ */
+type CacheMetrics struct {
+	Hits      uint64
+	Misses    uint64
+	Evictions uint64  // entries removed for capacity or expired
+	Size      int     // entries in cache
+}
+
+func (metrics CacheMetrics) HitRate() float64 {
+	total := metrics.Hits + metrics.Misses
+	if total == 0 {
+		return 0
+	}
+	return float64(metrics.Hits) / float64(total)
+}
+
+/**
+ *  Message Cache
+ *  ~~~~~~~~~~~~~
+ *  Relays may see the same forwarded message many times, this cache keeps
+ *  the verification results by message digest, so they can skip
+ *  re-verification.
+ *
+ *  Only the result is kept, not the message objects: they have lazy state
+ *  and pooled buffers which can't be shared among goroutines, and parsing
+ *  is lazy (cheap) already, so each caller parses its own message.
+ *
+ *  Memory is bounded by capacity (least recently used entries evicted first)
+ *  and entries expire after TTL.
+ */
+type MessageCache struct {
+	_capacity int
+	_ttl time.Duration
+
+	_entries map[string]*list.Element
+	_order *list.List  // front: most recently used
+
+	_metrics CacheMetrics
+	_lock sync.Mutex
+}
+
+// verified message
+type cacheEntry struct {
+	key string  // digest of the whole message, see cacheKey()
+	expires time.Time
+}
+
+func NewMessageCache(capacity int, ttl time.Duration) *MessageCache {
+	cache := new(MessageCache)
+	cache.Init(capacity, ttl)
+	return cache
+}
+
+func (cache *MessageCache) Init(capacity int, ttl time.Duration) *MessageCache {
+	cache._capacity = capacity
+	cache._ttl = ttl
+	cache._entries = make(map[string]*list.Element, capacity)
+	cache._order = list.New()
+	cache._metrics = CacheMetrics{}
+	return cache
+}
+
+/**
+ *  Verify message, skip the signature verification if the same message
+ *  verified before; the SecureMessage returned is always a new object
+ *
+ * @param rMsg - reliable message
+ * @return SecureMessage, nil on signature not match
+ */
+func (cache *MessageCache) Verify(rMsg ReliableMessage) SecureMessage {
+	key := cacheKey(rMsg)
+	if key == "" {
+		return rMsg.Verify()
+	}
+	cache._lock.Lock()
+	verified := cache.lookup(key) != nil
+	cache._lock.Unlock()
+	if verified {
+		info := rMsg.CopyMap(false)
+		delete(info, "signature")
+		sMsg := SecureMessageParse(info)
+		if delegate := rMsg.Delegate(); sMsg != nil && delegate != nil {
+			sMsg.SetDelegate(delegate)
+		}
+		return sMsg
+	}
+	// verify without lock
+	sMsg := rMsg.Verify()
+	if sMsg == nil {
+		return nil
+	}
+	cache._lock.Lock()
+	cache.store(key)
+	cache._lock.Unlock()
+	return sMsg
+}
+
+/**
+ *  Remove expired entries
+ *
+ * @return count of removed entries
+ */
+func (cache *MessageCache) Purge(now time.Time) int {
+	cache._lock.Lock()
+	defer cache._lock.Unlock()
+	count := 0
+	for element := cache._order.Back(); element != nil; {
+		prev := element.Prev()
+		entry := element.Value.(*cacheEntry)
+		if !now.Before(entry.expires) {
+			cache.remove(element)
+			count++
+		}
+		element = prev
+	}
+	return count
+}
+
+func (cache *MessageCache) Metrics() CacheMetrics {
+	cache._lock.Lock()
+	defer cache._lock.Unlock()
+	metrics := cache._metrics
+	metrics.Size = cache._order.Len()
+	return metrics
+}
+
+/**
+ *  Cache key: hex(sha256(canonical JsON of the whole message))
+ *
+ *  Split copies of a group message share 'data' and 'signature' but differ
+ *  in 'receiver' and 'key', and the signature may cover envelope fields
+ *  (AAD), so any field changed means a different message here.
+ */
+func cacheKey(rMsg ReliableMessage) string {
+	blob, err := CanonicalJSON(rMsg.Map())
+	if err != nil {
+		return ""
+	}
+	return hex.EncodeToString(SHA256(blob))
+}
+
+// call with lock
+func (cache *MessageCache) lookup(key string) *cacheEntry {
+	element := cache._entries[key]
+	if element == nil {
+		cache._metrics.Misses++
+		return nil
+	}
+	entry := element.Value.(*cacheEntry)
+	if !time.Now().Before(entry.expires) {
+		cache.remove(element)
+		cache._metrics.Misses++
+		return nil
+	}
+	cache._order.MoveToFront(element)
+	cache._metrics.Hits++
+	return entry
+}
+
+// call with lock
+func (cache *MessageCache) store(key string) *cacheEntry {
+	entry := &cacheEntry{
+		key: key,
+		expires: time.Now().Add(cache._ttl),
+	}
+	if element := cache._entries[key]; element != nil {
+		cache.remove(element)
+	}
+	cache._entries[key] = cache._order.PushFront(entry)
+	for cache._capacity > 0 && cache._order.Len() > cache._capacity {
+		cache.remove(cache._order.Back())
+	}
+	return entry
+}
+
+// call with lock
+func (cache *MessageCache) remove(element *list.Element) {
+	entry := cache._order.Remove(element).(*cacheEntry)
+	delete(cache._entries, entry.key)
+	cache._metrics.Evictions++
+}
@@ -0,0 +1,90 @@
+/* license: https://mit-license.org
+ *
+ *  Dao-Ke-Dao: Universal Message Module
+ *
+ *                                Written in 2022 by Moky <albert.moky@gmail.com>
+ *
+ * ==============================================================================
+ * The MIT License (MIT)
+ *
+ * Copyright (c) 2022 Albert Moky
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ * ==============================================================================
+ */
+package dkd
+
+import (
+	"bytes"
+	"encoding/json"
+	"sort"
+	. "github.com/dimchat/mkm-go/types"
+)
+
+/**
+ *  Get keys of the map in ascending order
+ */
+func SortedKeys(dict map[string]interface{}) []string {
+	keys := make([]string, 0, len(dict))
+	for key := range dict {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+/**
+ *  Encode map to byte-stable JsON:
+ *      1. keys in ascending order (at all levels);
+ *      2. no HTML escaping ('<', '>', '&' kept as they are);
+ *      3. Mapper values (Meta, Visa, ...) encoded as their maps;
+ *      4. no trailing newline.
+ *
+ *  for reproducible archives, caching keys and signature-over-canonical-form
+ */
+func CanonicalJSON(dict map[string]interface{}) ([]byte, error) {
+	var buffer bytes.Buffer
+	encoder := json.NewEncoder(&buffer)
+	encoder.SetEscapeHTML(false)
+	// encoding/json sorts map keys itself
+	if err := encoder.Encode(canonicalValue(dict)); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(buffer.Bytes(), []byte{'\n'}), nil
+}
+
+func canonicalValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case Mapper:
+		return canonicalValue(v.Map())
+	case map[string]interface{}:
+		info := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			info[key] = canonicalValue(item)
+		}
+		return info
+	case []interface{}:
+		array := make([]interface{}, len(v))
+		for index, item := range v {
+			array[index] = canonicalValue(item)
+		}
+		return array
+	}
+	return value
+}
@@ -0,0 +1,97 @@
+/* license: https://mit-license.org
+ *
+ *  Dao-Ke-Dao: Universal Message Module
+ *
+ *                                Written in 2022 by Moky <albert.moky@gmail.com>
+ *
+ * ==============================================================================
+ * The MIT License (MIT)
+ *
+ * Copyright (c) 2022 Albert Moky
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ * ==============================================================================
+ */
+package dkd
+
+import (
+	. "github.com/dimchat/dkd-go/protocol"
+	. "github.com/dimchat/mkm-go/crypto"
+	. "github.com/dimchat/mkm-go/protocol"
+)
+
+/**
+ *  Carbon Copy to Self
+ *  ~~~~~~~~~~~~~~~~~~~
+ *  Encrypt additional copies of an outgoing message for the sender's
+ *  other devices, so the conversation can be synchronized among them;
+ *  each copy is addressed to the device and marked with 'carbon',
+ *  which keeps the original receiver.
+ *
+ * @param iMsg     - outgoing message
+ * @param password - symmetric key used for the original message
+ * @param devices  - sender's other devices
+ * @return secure messages, one for each device
+ */
+func CarbonCopyToSelf(iMsg InstantMessage, password SymmetricKey, devices []ID) []SecureMessage {
+	receiver := iMsg.Receiver()
+	messages := make([]SecureMessage, 0, len(devices))
+	for _, device := range devices {
+		info := iMsg.CopyMap(false)
+		info["receiver"] = device.String()
+		// keys for the carbon copy are only for the device
+		delete(info, "receivers")
+		EnvelopeSetCarbon(info, receiver)
+		copied := InstantMessageParse(info)
+		if copied == nil {
+			continue
+		}
+		if delegate := iMsg.Delegate(); delegate != nil {
+			copied.SetDelegate(delegate)
+		}
+		sMsg := copied.Encrypt(password, nil)
+		if sMsg != nil {
+			messages = append(messages, sMsg)
+		}
+	}
+	return messages
+}
+
+/**
+ *  Check whether the message is a carbon copy from another device of mine,
+ *  a 'carbon' from other senders is not trusted
+ *
+ * @param msg  - received message
+ * @param self - my ID (the terminal is ignored)
+ * @return true when it's sent by myself with 'carbon'
+ */
+func IsCarbonCopy(msg Message, self ID) bool {
+	if EnvelopeGetCarbon(msg.Map()) == nil {
+		return false
+	}
+	sender := msg.Sender()
+	return sender != nil && sender.Name() == self.Name() && sender.Address().Equal(self.Address())
+}
+
+/**
+ *  Get the original receiver of a carbon copy, nil for normal message
+ */
+func CarbonCopyReceiver(msg Message) ID {
+	return EnvelopeGetCarbon(msg.Map())
+}
@@ -0,0 +1,138 @@
+/* license: https://mit-license.org
+ *
+ *  Dao-Ke-Dao: Universal Message Module
+ *
+ *                                Written in 2022 by Moky <albert.moky@gmail.com>
+ *
+ * ==============================================================================
+ * The MIT License (MIT)
+ *
+ * Copyright (c) 2022 Albert Moky
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ * ==============================================================================
+ */
+package dkd
+
+import (
+	"sync"
+	. "github.com/dimchat/dkd-go/protocol"
+	. "github.com/dimchat/mkm-go/protocol"
+)
+
+/**
+ *  Chain Builder
+ *  ~~~~~~~~~~~~~
+ *  Sender side: links each content to the previous message
+ *  sent to the same conversation (receiver or group).
+ *
+ *      content := ...
+ *      builder.Link(content, conversation)
+ *      rMsg := ...Encrypt(...).Sign()
+ *      builder.Commit(conversation, rMsg)
+ */
+type ChainBuilder struct {
+	_last map[string]string  // conversation -> fingerprint
+	_lock sync.Mutex
+}
+
+func NewChainBuilder() *ChainBuilder {
+	builder := new(ChainBuilder)
+	builder.Init()
+	return builder
+}
+
+func (builder *ChainBuilder) Init() *ChainBuilder {
+	builder._last = make(map[string]string)
+	return builder
+}
+
+/**
+ *  Set 'prev' with the last message sent to the conversation
+ */
+func (builder *ChainBuilder) Link(content Content, conversation ID) {
+	builder._lock.Lock()
+	prev := builder._last[conversation.String()]
+	builder._lock.Unlock()
+	ContentSetPrev(content.Map(), prev)
+}
+
+/**
+ *  Record the message as the last one of the conversation
+ */
+func (builder *ChainBuilder) Commit(conversation ID, rMsg ReliableMessage) {
+	fingerprint := MessageFingerprint(rMsg)
+	builder._lock.Lock()
+	defer builder._lock.Unlock()
+	builder._last[conversation.String()] = fingerprint
+}
+
+type ChainStatus uint8
+
+const (
+	ChainStart  ChainStatus = 0  // no 'prev', or first message seen from the sender
+	ChainLinked ChainStatus = 1  // 'prev' matches the last message received
+	ChainBroken ChainStatus = 2  // message(s) dropped or reordered in between
+)
+
+/**
+ *  Chain Verifier
+ *  ~~~~~~~~~~~~~~
+ *  Receiver side: checks 'prev' with the last message received
+ *  from the same sender in the conversation.
+ */
+type ChainVerifier struct {
+	_last map[string]string  // sender + conversation -> fingerprint
+	_lock sync.Mutex
+}
+
+func NewChainVerifier() *ChainVerifier {
+	verifier := new(ChainVerifier)
+	verifier.Init()
+	return verifier
+}
+
+func (verifier *ChainVerifier) Init() *ChainVerifier {
+	verifier._last = make(map[string]string)
+	return verifier
+}
+
+/**
+ *  Check the decrypted message, and record it as the last one
+ *
+ * @param iMsg - decrypted message
+ * @param rMsg - the received message, for fingerprint
+ * @return chain status
+ */
+func (verifier *ChainVerifier) Check(iMsg InstantMessage, rMsg ReliableMessage) ChainStatus {
+	// conversation from the sender's view: group, or me
+	key := iMsg.Sender().String() + "|" + ExpandedReceiver(iMsg).String()
+	prev := ContentGetPrev(iMsg.Content().Map())
+	fingerprint := MessageFingerprint(rMsg)
+	verifier._lock.Lock()
+	defer verifier._lock.Unlock()
+	last, known := verifier._last[key]
+	verifier._last[key] = fingerprint
+	if prev == "" || !known {
+		return ChainStart
+	} else if prev == last {
+		return ChainLinked
+	}
+	return ChainBroken
+}
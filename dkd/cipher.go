@@ -0,0 +1,106 @@
+/* license: https://mit-license.org
+ *
+ *  Dao-Ke-Dao: Universal Message Module
+ *
+ *                                Written in 2022 by Moky <albert.moky@gmail.com>
+ *
+ * ==============================================================================
+ * The MIT License (MIT)
+ *
+ * Copyright (c) 2022 Albert Moky
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ * ==============================================================================
+ */
+package dkd
+
+import (
+	"sync"
+	. "github.com/dimchat/mkm-go/protocol"
+)
+
+/**
+ *  Choose the first cipher in local preferences which the peer supports
+ *
+ * @param preferred - local ciphers, most preferred first
+ * @param supported - ciphers supported by the peer
+ * @return cipher name; empty string when nothing in common
+ */
+func NegotiateCipher(preferred []string, supported []string) string {
+	for _, cipher := range preferred {
+		for _, item := range supported {
+			if item == cipher {
+				return cipher
+			}
+		}
+	}
+	return ""
+}
+
+/**
+ *  Cipher Negotiator
+ *  ~~~~~~~~~~~~~~~~~
+ *  Keeps ciphers supported by each receiver (e.g.: learned from visa),
+ *  for the delegate to choose the content encryption algorithm.
+ */
+type CipherNegotiator struct {
+	_preferred []string
+	_fallback string  // for receivers not known yet
+
+	_supported map[string][]string
+	_lock sync.RWMutex
+}
+
+func NewCipherNegotiator(preferred []string, fallback string) *CipherNegotiator {
+	negotiator := new(CipherNegotiator)
+	negotiator.Init(preferred, fallback)
+	return negotiator
+}
+
+func (negotiator *CipherNegotiator) Init(preferred []string, fallback string) *CipherNegotiator {
+	negotiator._preferred = preferred
+	negotiator._fallback = fallback
+	negotiator._supported = make(map[string][]string)
+	return negotiator
+}
+
+func (negotiator *CipherNegotiator) SetSupported(receiver ID, ciphers []string) {
+	negotiator._lock.Lock()
+	defer negotiator._lock.Unlock()
+	negotiator._supported[receiver.String()] = ciphers
+}
+
+/**
+ *  Choose cipher for the receiver
+ *
+ * @return negotiated cipher, or fallback
+ */
+func (negotiator *CipherNegotiator) Choose(receiver ID) string {
+	negotiator._lock.RLock()
+	supported, ok := negotiator._supported[receiver.String()]
+	negotiator._lock.RUnlock()
+	if !ok {
+		return negotiator._fallback
+	}
+	cipher := NegotiateCipher(negotiator._preferred, supported)
+	if cipher == "" {
+		return negotiator._fallback
+	}
+	return cipher
+}
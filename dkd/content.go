@@ -31,6 +31,8 @@
 package dkd
 
 import (
+	"crypto/rand"
+	"fmt"
 	. "github.com/dimchat/dkd-go/protocol"
 	. "github.com/dimchat/mkm-go/protocol"
 	. "github.com/dimchat/mkm-go/types"
@@ -44,6 +46,7 @@ import (
  *  data format: {
  *      'type'    : 0x00,            // message type
  *      'sn'      : 0,               // serial number
+ *      'uuid'    : 'UUID',          // idempotency token, OPTIONAL
  *
  *      'group'   : 'Group ID',      // for group message
  *
@@ -64,6 +67,11 @@ type BaseContent struct {
 
 	// message time
 	_time Time
+
+	// group ID for group message
+	_group ID
+	_groupRaw interface{}  // value of 'group' when parsed, see rawMatch()
+	_groupLoaded bool
 }
 
 /* designated initializer */
@@ -73,10 +81,22 @@ func (content *BaseContent) Init(dict map[string]interface{}) Content {
 		content._type = 0
 		content._sn = 0
 		content._time = TimeNil()
+		content._group = nil
+		content._groupLoaded = false
 	}
 	return content
 }
 
+var autoUUID = false
+
+/**
+ *  Enable/disable random 'uuid' for new contents (default off),
+ *  or set it with SetUUID() for the contents that need it
+ */
+func ContentSetAutoUUID(flag bool) {
+	autoUUID = flag
+}
+
 /* designated initializer */
 func (content *BaseContent) InitWithType(msgType ContentType) Content {
 	// message time
@@ -88,10 +108,32 @@ func (content *BaseContent) InitWithType(msgType ContentType) Content {
 	dict["type"] = msgType
 	dict["sn"] = sn
 	dict["time"] = TimeToFloat64(now)
+	if autoUUID {
+		ContentSetUUID(dict, generateUUID())
+	}
 	if content.Dictionary.Init(dict) != nil {
 		content._type = msgType
 		content._sn = sn
 		content._time = now
+		content._group = nil
+		content._groupLoaded = false
+	}
+	return content
+}
+
+/* designated initializer */
+func (content *BaseContent) InitWithSN(msgType ContentType, sn uint64, when Time) Content {
+	// build content info without random fields
+	dict := make(map[string]interface{})
+	dict["type"] = msgType
+	dict["sn"] = sn
+	dict["time"] = TimeToFloat64(when)
+	if content.Dictionary.Init(dict) != nil {
+		content._type = msgType
+		content._sn = sn
+		content._time = when
+		content._group = nil
+		content._groupLoaded = false
 	}
 	return content
 }
@@ -119,10 +161,39 @@ func (content *BaseContent) Time() Time {
 	return content._time
 }
 
+func (content *BaseContent) UUID() string {
+	return ContentGetUUID(content.Map())
+}
+
+func (content *BaseContent) SetUUID(uuid string) {
+	ContentSetUUID(content.Map(), uuid)
+}
+
 func (content *BaseContent) Group() ID {
-	return ContentGetGroup(content.Map())
+	raw := content.Get("group")
+	if !content._groupLoaded || !rawMatch(content._groupRaw, raw) {
+		// absent 'group' is cached too, until it's written
+		content._group = ContentGetGroup(content.Map())
+		content._groupRaw = raw
+		content._groupLoaded = true
+	}
+	return content._group
 }
 
 func (content *BaseContent) SetGroup(group ID)  {
 	ContentSetGroup(content.Map(), group)
+	content._group = group
+	content._groupRaw = content.Get("group")
+	content._groupLoaded = true
+}
+
+// random UUID (version 4), empty when no randomness available
+func generateUUID() string {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return ""
+	}
+	b[6] = (b[6] & 0x0F) | 0x40  // version 4
+	b[8] = (b[8] & 0x3F) | 0x80  // variant 10
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
 }
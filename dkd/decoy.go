@@ -0,0 +1,138 @@
+/* license: https://mit-license.org
+ *
+ *  Dao-Ke-Dao: Universal Message Module
+ *
+ *                                Written in 2022 by Moky <albert.moky@gmail.com>
+ *
+ * ==============================================================================
+ * The MIT License (MIT)
+ *
+ * Copyright (c) 2022 Albert Moky
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ * ==============================================================================
+ */
+package dkd
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	mrand "math/rand"
+	"time"
+	. "github.com/dimchat/dkd-go/protocol"
+	. "github.com/dimchat/mkm-go/crypto"
+	. "github.com/dimchat/mkm-go/protocol"
+	. "github.com/dimchat/mkm-go/types"
+)
+
+/**
+ *  Decoy Generator
+ *  ~~~~~~~~~~~~~~~
+ *  Produces dummy messages for traffic-analysis resistance,
+ *  they go through the same factories & transforms as the real ones,
+ *  so they are structurally indistinguishable on the wire.
+ */
+type DecoyGenerator struct {
+
+	_delegate MessageDelegate
+
+	_sender ID
+	_sink ID  // receiver for decoys, e.g.: sender itself
+
+	_msgType ContentType
+	_algorithm string  // symmetric key algorithm
+
+	_minPadding int
+	_maxPadding int
+}
+
+func NewDecoyGenerator(delegate MessageDelegate, sender ID, sink ID, msgType ContentType, algorithm string) *DecoyGenerator {
+	generator := new(DecoyGenerator)
+	generator.Init(delegate, sender, sink, msgType, algorithm)
+	return generator
+}
+
+func (generator *DecoyGenerator) Init(delegate MessageDelegate, sender ID, sink ID, msgType ContentType, algorithm string) *DecoyGenerator {
+	generator._delegate = delegate
+	generator._sender = sender
+	generator._sink = sink
+	generator._msgType = msgType
+	generator._algorithm = algorithm
+	generator._minPadding = 16
+	generator._maxPadding = 512
+	return generator
+}
+
+// size range of random padding in content
+func (generator *DecoyGenerator) SetPaddingRange(min int, max int) {
+	generator._minPadding = min
+	generator._maxPadding = max
+}
+
+/**
+ *  Generate a decoy message
+ *
+ * @return signed message
+ */
+func (generator *DecoyGenerator) Generate() ReliableMessage {
+	content := new(BaseContent).InitWithType(generator._msgType)
+	size := generator._minPadding
+	if generator._maxPadding > size {
+		size += mrand.Intn(generator._maxPadding - size + 1)
+	}
+	padding := make([]byte, size)
+	if _, err := rand.Read(padding); err != nil {
+		panic(err)
+	}
+	content.Set("padding", base64.StdEncoding.EncodeToString(padding))
+
+	env := EnvelopeCreate(generator._sender, generator._sink, TimeNow())
+	env.SetType(generator._msgType)
+	iMsg := InstantMessageCreate(env, content)
+	iMsg.SetDelegate(generator._delegate)
+	password := SymmetricKeyGenerate(generator._algorithm)
+	sMsg := iMsg.Encrypt(password, nil)
+	if sMsg == nil {
+		return nil
+	}
+	sMsg.SetDelegate(generator._delegate)
+	return sMsg.Sign()
+}
+
+/**
+ *  Emit decoys until stopped
+ *
+ * @param interval - average interval
+ * @param stop     - close to stop
+ * @param emit     - callback for each decoy
+ */
+func (generator *DecoyGenerator) Run(interval time.Duration, stop <-chan struct{}, emit func(rMsg ReliableMessage)) {
+	for {
+		// random delay in [interval/2, interval*3/2)
+		delay := interval / 2 + time.Duration(mrand.Int63n(int64(interval) + 1))
+		select {
+		case <-stop:
+			return
+		case <-time.After(delay):
+		}
+		if rMsg := generator.Generate(); rMsg != nil {
+			emit(rMsg)
+		}
+	}
+}
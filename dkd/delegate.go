@@ -0,0 +1,619 @@
+/* license: https://mit-license.org
+ *
+ *  Dao-Ke-Dao: Universal Message Module
+ *
+ *                                Written in 2022 by Moky <albert.moky@gmail.com>
+ *
+ * ==============================================================================
+ * The MIT License (MIT)
+ *
+ * Copyright (c) 2022 Albert Moky
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ * ==============================================================================
+ */
+package dkd
+
+import (
+	"context"
+	"time"
+	. "github.com/dimchat/dkd-go/protocol"
+	. "github.com/dimchat/mkm-go/crypto"
+	. "github.com/dimchat/mkm-go/protocol"
+)
+
+/**
+ *  Delegate Call
+ *  ~~~~~~~~~~~~~
+ *  Metadata of one delegate invocation
+ */
+type DelegateCall struct {
+	Method     string
+	Message    Message  // message object passed to delegate
+	InputSize  int      // -1 for non-data input
+	OutputSize int      // -1 for non-data output
+	Duration   time.Duration
+	Nil        bool     // delegate returned nil (or false for verification)
+}
+
+/**
+ *  Delegate Hooks
+ *  ~~~~~~~~~~~~~~
+ */
+type DelegateHooks interface {
+
+	// called after each delegate method returned,
+	// async results are reported from other goroutines
+	OnCall(call *DelegateCall)
+}
+
+/**
+ *  Wrap message delegate to record every invocation,
+ *  e.g.: contract tests for custom delegates
+ *
+ *  The optional interfaces (AADDelegate, AsyncDelegate, CipherDelegate,
+ *  KeyDigestDelegate, BufferedDataDecoder) are forwarded (and recorded)
+ *  only when the inner delegate implements them; the wrapper implements
+ *  exactly those, so it takes the same code path as the inner one;
+ *  SessionKeyDelegate is always implemented, forwarding nil if not supported.
+ *
+ * @param delegate - message delegate
+ * @param hooks    - invocation callback
+ * @return wrapped delegate
+ */
+func WrapDelegate(delegate MessageDelegate, hooks DelegateHooks) MessageDelegate {
+	return wrapOptional(&tracingDelegate{_inner: delegate, _hooks: hooks})
+}
+
+type tracingDelegate struct {
+	_inner MessageDelegate
+	_hooks DelegateHooks
+}
+
+func (tracer *tracingDelegate) record(method string, msg Message, in int, out int, isNil bool, start time.Time) {
+	tracer._hooks.OnCall(&DelegateCall{
+		Method:     method,
+		Message:    msg,
+		InputSize:  in,
+		OutputSize: out,
+		Duration:   time.Since(start),
+		Nil:        isNil,
+	})
+}
+
+func sizeOf(value interface{}) int {
+	switch v := value.(type) {
+	case []byte:
+		return len(v)
+	case string:
+		return len(v)
+	}
+	return -1
+}
+
+//-------- IInstantMessageDelegate
+
+func (tracer *tracingDelegate) SerializeContent(content Content, password SymmetricKey, iMsg InstantMessage) []byte {
+	start := time.Now()
+	data := tracer._inner.SerializeContent(content, password, iMsg)
+	tracer.record("SerializeContent", iMsg, -1, len(data), data == nil, start)
+	return data
+}
+
+func (tracer *tracingDelegate) EncryptContent(data []byte, password SymmetricKey, iMsg InstantMessage) []byte {
+	start := time.Now()
+	res := tracer._inner.EncryptContent(data, password, iMsg)
+	tracer.record("EncryptContent", iMsg, len(data), len(res), res == nil, start)
+	return res
+}
+
+func (tracer *tracingDelegate) EncodeData(data []byte, iMsg InstantMessage) string {
+	start := time.Now()
+	res := tracer._inner.EncodeData(data, iMsg)
+	tracer.record("EncodeData", iMsg, len(data), len(res), res == "", start)
+	return res
+}
+
+func (tracer *tracingDelegate) SerializeKey(password SymmetricKey, iMsg InstantMessage) []byte {
+	start := time.Now()
+	res := tracer._inner.SerializeKey(password, iMsg)
+	tracer.record("SerializeKey", iMsg, -1, len(res), res == nil, start)
+	return res
+}
+
+func (tracer *tracingDelegate) EncryptKey(data []byte, receiver ID, iMsg InstantMessage) []byte {
+	start := time.Now()
+	res := tracer._inner.EncryptKey(data, receiver, iMsg)
+	tracer.record("EncryptKey", iMsg, len(data), len(res), res == nil, start)
+	return res
+}
+
+func (tracer *tracingDelegate) EncodeKey(data []byte, iMsg InstantMessage) string {
+	start := time.Now()
+	res := tracer._inner.EncodeKey(data, iMsg)
+	tracer.record("EncodeKey", iMsg, len(data), len(res), res == "", start)
+	return res
+}
+
+//-------- ISecureMessageDelegate
+
+func (tracer *tracingDelegate) DecodeKey(key interface{}, sMsg SecureMessage) []byte {
+	start := time.Now()
+	res := tracer._inner.DecodeKey(key, sMsg)
+	tracer.record("DecodeKey", sMsg, sizeOf(key), len(res), res == nil, start)
+	return res
+}
+
+func (tracer *tracingDelegate) DecryptKey(key []byte, sender ID, receiver ID, sMsg SecureMessage) []byte {
+	start := time.Now()
+	res := tracer._inner.DecryptKey(key, sender, receiver, sMsg)
+	tracer.record("DecryptKey", sMsg, len(key), len(res), res == nil, start)
+	return res
+}
+
+func (tracer *tracingDelegate) DeserializeKey(key []byte, sender ID, receiver ID, sMsg SecureMessage) SymmetricKey {
+	start := time.Now()
+	res := tracer._inner.DeserializeKey(key, sender, receiver, sMsg)
+	tracer.record("DeserializeKey", sMsg, len(key), -1, res == nil, start)
+	return res
+}
+
+func (tracer *tracingDelegate) DecodeData(data interface{}, sMsg SecureMessage) []byte {
+	start := time.Now()
+	res := tracer._inner.DecodeData(data, sMsg)
+	tracer.record("DecodeData", sMsg, sizeOf(data), len(res), res == nil, start)
+	return res
+}
+
+func (tracer *tracingDelegate) DecryptContent(data []byte, password SymmetricKey, sMsg SecureMessage) []byte {
+	start := time.Now()
+	res := tracer._inner.DecryptContent(data, password, sMsg)
+	tracer.record("DecryptContent", sMsg, len(data), len(res), res == nil, start)
+	return res
+}
+
+func (tracer *tracingDelegate) DeserializeContent(data []byte, password SymmetricKey, sMsg SecureMessage) Content {
+	start := time.Now()
+	res := tracer._inner.DeserializeContent(data, password, sMsg)
+	tracer.record("DeserializeContent", sMsg, len(data), -1, res == nil, start)
+	return res
+}
+
+func (tracer *tracingDelegate) SignData(data []byte, sender ID, sMsg SecureMessage) []byte {
+	start := time.Now()
+	res := tracer._inner.SignData(data, sender, sMsg)
+	tracer.record("SignData", sMsg, len(data), len(res), res == nil, start)
+	return res
+}
+
+func (tracer *tracingDelegate) EncodeSignature(signature []byte, sMsg SecureMessage) string {
+	start := time.Now()
+	res := tracer._inner.EncodeSignature(signature, sMsg)
+	tracer.record("EncodeSignature", sMsg, len(signature), len(res), res == "", start)
+	return res
+}
+
+//-------- IReliableMessageDelegate
+
+func (tracer *tracingDelegate) DecodeSignature(signature interface{}, rMsg ReliableMessage) []byte {
+	start := time.Now()
+	res := tracer._inner.DecodeSignature(signature, rMsg)
+	tracer.record("DecodeSignature", rMsg, sizeOf(signature), len(res), res == nil, start)
+	return res
+}
+
+func (tracer *tracingDelegate) VerifyDataSignature(data []byte, signature []byte, sender ID, rMsg ReliableMessage) bool {
+	start := time.Now()
+	ok := tracer._inner.VerifyDataSignature(data, signature, sender, rMsg)
+	tracer.record("VerifyDataSignature", rMsg, len(data), -1, !ok, start)
+	return ok
+}
+
+//-------- SessionKeyDelegate
+//
+//  always implemented, nil means no sessions as for a plain delegate
+//
+
+func (tracer *tracingDelegate) SessionKeys() SessionKeyProvider {
+	return sessionKeys(tracer._inner)
+}
+
+//-------- optional interfaces
+//
+//  each one is a separate type, WrapDelegate embeds only those
+//  implemented by the inner delegate (see wrapOptional)
+//
+
+type tracingAAD struct {
+	*tracingDelegate
+}
+
+type tracingAsync struct {
+	*tracingDelegate
+}
+
+type tracingCipher struct {
+	*tracingDelegate
+}
+
+type tracingKeyDigest struct {
+	*tracingDelegate
+}
+
+type tracingBuffered struct {
+	*tracingDelegate
+}
+
+func (tracer tracingAAD) EncryptContentWithAAD(data []byte, aad []byte, password SymmetricKey, iMsg InstantMessage) []byte {
+	start := time.Now()
+	res := tracer._inner.(AADDelegate).EncryptContentWithAAD(data, aad, password, iMsg)
+	tracer.record("EncryptContentWithAAD", iMsg, len(data), len(res), res == nil, start)
+	return res
+}
+
+func (tracer tracingAAD) DecryptContentWithAAD(data []byte, aad []byte, password SymmetricKey, sMsg SecureMessage) []byte {
+	start := time.Now()
+	res := tracer._inner.(AADDelegate).DecryptContentWithAAD(data, aad, password, sMsg)
+	tracer.record("DecryptContentWithAAD", sMsg, len(data), len(res), res == nil, start)
+	return res
+}
+
+func (tracer tracingAsync) SignDataAsync(ctx context.Context, data []byte, sender ID, sMsg SecureMessage) <-chan []byte {
+	start := time.Now()
+	return tracer.relay("SignDataAsync", sMsg, len(data), start,
+		tracer._inner.(AsyncDelegate).SignDataAsync(ctx, data, sender, sMsg))
+}
+
+func (tracer tracingAsync) DecryptKeyAsync(ctx context.Context, key []byte, sender ID, receiver ID, sMsg SecureMessage) <-chan []byte {
+	start := time.Now()
+	return tracer.relay("DecryptKeyAsync", sMsg, len(key), start,
+		tracer._inner.(AsyncDelegate).DecryptKeyAsync(ctx, key, sender, receiver, sMsg))
+}
+
+// record the async result when it arrives
+func (tracer *tracingDelegate) relay(method string, msg Message, in int, start time.Time, result <-chan []byte) <-chan []byte {
+	out := make(chan []byte, 1)
+	go func() {
+		res, ok := <-result
+		tracer.record(method, msg, in, len(res), res == nil, start)
+		if ok {
+			out <- res
+		}
+		close(out)
+	}()
+	return out
+}
+
+func (tracer tracingCipher) ContentCipher(password SymmetricKey, iMsg InstantMessage) string {
+	start := time.Now()
+	res := tracer._inner.(CipherDelegate).ContentCipher(password, iMsg)
+	tracer.record("ContentCipher", iMsg, -1, len(res), res == "", start)
+	return res
+}
+
+func (tracer tracingKeyDigest) DigestKey(password SymmetricKey, iMsg InstantMessage) string {
+	start := time.Now()
+	res := tracer._inner.(KeyDigestDelegate).DigestKey(password, iMsg)
+	tracer.record("DigestKey", iMsg, -1, len(res), res == "", start)
+	return res
+}
+
+func (tracer tracingKeyDigest) RequestKey(digest string, sMsg SecureMessage) {
+	start := time.Now()
+	tracer._inner.(KeyDigestDelegate).RequestKey(digest, sMsg)
+	tracer.record("RequestKey", sMsg, len(digest), -1, false, start)
+}
+
+func (tracer tracingBuffered) DecodeDataInto(buffer []byte, data interface{}, sMsg SecureMessage) []byte {
+	start := time.Now()
+	res := tracer._inner.(BufferedDataDecoder).DecodeDataInto(buffer, data, sMsg)
+	tracer.record("DecodeDataInto", sMsg, sizeOf(data), len(res), res == nil, start)
+	return res
+}
+
+func (tracer tracingBuffered) DecodeKeyInto(buffer []byte, key interface{}, sMsg SecureMessage) []byte {
+	start := time.Now()
+	res := tracer._inner.(BufferedDataDecoder).DecodeKeyInto(buffer, key, sMsg)
+	tracer.record("DecodeKeyInto", sMsg, sizeOf(key), len(res), res == nil, start)
+	return res
+}
+
+func (tracer tracingBuffered) DecodeSignatureInto(buffer []byte, signature interface{}, rMsg ReliableMessage) []byte {
+	start := time.Now()
+	res := tracer._inner.(BufferedDataDecoder).DecodeSignatureInto(buffer, signature, rMsg)
+	tracer.record("DecodeSignatureInto", rMsg, sizeOf(signature), len(res), res == nil, start)
+	return res
+}
+
+//
+//  Optional interface lookup
+//
+
+func aadDelegate(delegate MessageDelegate) (AADDelegate, bool) {
+	sealer, ok := delegate.(AADDelegate)
+	return sealer, ok
+}
+
+func asyncDelegate(delegate MessageDelegate) (AsyncDelegate, bool) {
+	async, ok := delegate.(AsyncDelegate)
+	return async, ok
+}
+
+func cipherDelegate(delegate MessageDelegate) (CipherDelegate, bool) {
+	named, ok := delegate.(CipherDelegate)
+	return named, ok
+}
+
+func keyDigestDelegate(delegate MessageDelegate) (KeyDigestDelegate, bool) {
+	digester, ok := delegate.(KeyDigestDelegate)
+	return digester, ok
+}
+
+func sessionKeys(delegate MessageDelegate) SessionKeyProvider {
+	if sessions, ok := delegate.(SessionKeyDelegate); ok {
+		return sessions.SessionKeys()
+	}
+	return nil
+}
+
+func bufferedDataDecoder(delegate MessageDelegate) (BufferedDataDecoder, bool) {
+	decoder, ok := delegate.(BufferedDataDecoder)
+	return decoder, ok
+}
+
+//
+//  Wrapper with exactly the optional interfaces of the inner delegate,
+//  so type assertions on it agree with the inner one
+//
+
+const (
+	optAAD = 1 << iota
+	optAsync
+	optCipher
+	optKeyDigest
+	optBuffered
+)
+
+func wrapOptional(tracer *tracingDelegate) MessageDelegate {
+	mask := 0
+	if _, ok := tracer._inner.(AADDelegate); ok {
+		mask |= optAAD
+	}
+	if _, ok := tracer._inner.(AsyncDelegate); ok {
+		mask |= optAsync
+	}
+	if _, ok := tracer._inner.(CipherDelegate); ok {
+		mask |= optCipher
+	}
+	if _, ok := tracer._inner.(KeyDigestDelegate); ok {
+		mask |= optKeyDigest
+	}
+	if _, ok := tracer._inner.(BufferedDataDecoder); ok {
+		mask |= optBuffered
+	}
+	aad, async, named := tracingAAD{tracer}, tracingAsync{tracer}, tracingCipher{tracer}
+	digester, decoder := tracingKeyDigest{tracer}, tracingBuffered{tracer}
+	switch mask {
+	case optAAD:
+		return struct {
+			*tracingDelegate
+			tracingAAD
+		}{tracer, aad}
+	case optAsync:
+		return struct {
+			*tracingDelegate
+			tracingAsync
+		}{tracer, async}
+	case optAAD | optAsync:
+		return struct {
+			*tracingDelegate
+			tracingAAD
+			tracingAsync
+		}{tracer, aad, async}
+	case optCipher:
+		return struct {
+			*tracingDelegate
+			tracingCipher
+		}{tracer, named}
+	case optAAD | optCipher:
+		return struct {
+			*tracingDelegate
+			tracingAAD
+			tracingCipher
+		}{tracer, aad, named}
+	case optAsync | optCipher:
+		return struct {
+			*tracingDelegate
+			tracingAsync
+			tracingCipher
+		}{tracer, async, named}
+	case optAAD | optAsync | optCipher:
+		return struct {
+			*tracingDelegate
+			tracingAAD
+			tracingAsync
+			tracingCipher
+		}{tracer, aad, async, named}
+	case optKeyDigest:
+		return struct {
+			*tracingDelegate
+			tracingKeyDigest
+		}{tracer, digester}
+	case optAAD | optKeyDigest:
+		return struct {
+			*tracingDelegate
+			tracingAAD
+			tracingKeyDigest
+		}{tracer, aad, digester}
+	case optAsync | optKeyDigest:
+		return struct {
+			*tracingDelegate
+			tracingAsync
+			tracingKeyDigest
+		}{tracer, async, digester}
+	case optAAD | optAsync | optKeyDigest:
+		return struct {
+			*tracingDelegate
+			tracingAAD
+			tracingAsync
+			tracingKeyDigest
+		}{tracer, aad, async, digester}
+	case optCipher | optKeyDigest:
+		return struct {
+			*tracingDelegate
+			tracingCipher
+			tracingKeyDigest
+		}{tracer, named, digester}
+	case optAAD | optCipher | optKeyDigest:
+		return struct {
+			*tracingDelegate
+			tracingAAD
+			tracingCipher
+			tracingKeyDigest
+		}{tracer, aad, named, digester}
+	case optAsync | optCipher | optKeyDigest:
+		return struct {
+			*tracingDelegate
+			tracingAsync
+			tracingCipher
+			tracingKeyDigest
+		}{tracer, async, named, digester}
+	case optAAD | optAsync | optCipher | optKeyDigest:
+		return struct {
+			*tracingDelegate
+			tracingAAD
+			tracingAsync
+			tracingCipher
+			tracingKeyDigest
+		}{tracer, aad, async, named, digester}
+	case optBuffered:
+		return struct {
+			*tracingDelegate
+			tracingBuffered
+		}{tracer, decoder}
+	case optAAD | optBuffered:
+		return struct {
+			*tracingDelegate
+			tracingAAD
+			tracingBuffered
+		}{tracer, aad, decoder}
+	case optAsync | optBuffered:
+		return struct {
+			*tracingDelegate
+			tracingAsync
+			tracingBuffered
+		}{tracer, async, decoder}
+	case optAAD | optAsync | optBuffered:
+		return struct {
+			*tracingDelegate
+			tracingAAD
+			tracingAsync
+			tracingBuffered
+		}{tracer, aad, async, decoder}
+	case optCipher | optBuffered:
+		return struct {
+			*tracingDelegate
+			tracingCipher
+			tracingBuffered
+		}{tracer, named, decoder}
+	case optAAD | optCipher | optBuffered:
+		return struct {
+			*tracingDelegate
+			tracingAAD
+			tracingCipher
+			tracingBuffered
+		}{tracer, aad, named, decoder}
+	case optAsync | optCipher | optBuffered:
+		return struct {
+			*tracingDelegate
+			tracingAsync
+			tracingCipher
+			tracingBuffered
+		}{tracer, async, named, decoder}
+	case optAAD | optAsync | optCipher | optBuffered:
+		return struct {
+			*tracingDelegate
+			tracingAAD
+			tracingAsync
+			tracingCipher
+			tracingBuffered
+		}{tracer, aad, async, named, decoder}
+	case optKeyDigest | optBuffered:
+		return struct {
+			*tracingDelegate
+			tracingKeyDigest
+			tracingBuffered
+		}{tracer, digester, decoder}
+	case optAAD | optKeyDigest | optBuffered:
+		return struct {
+			*tracingDelegate
+			tracingAAD
+			tracingKeyDigest
+			tracingBuffered
+		}{tracer, aad, digester, decoder}
+	case optAsync | optKeyDigest | optBuffered:
+		return struct {
+			*tracingDelegate
+			tracingAsync
+			tracingKeyDigest
+			tracingBuffered
+		}{tracer, async, digester, decoder}
+	case optAAD | optAsync | optKeyDigest | optBuffered:
+		return struct {
+			*tracingDelegate
+			tracingAAD
+			tracingAsync
+			tracingKeyDigest
+			tracingBuffered
+		}{tracer, aad, async, digester, decoder}
+	case optCipher | optKeyDigest | optBuffered:
+		return struct {
+			*tracingDelegate
+			tracingCipher
+			tracingKeyDigest
+			tracingBuffered
+		}{tracer, named, digester, decoder}
+	case optAAD | optCipher | optKeyDigest | optBuffered:
+		return struct {
+			*tracingDelegate
+			tracingAAD
+			tracingCipher
+			tracingKeyDigest
+			tracingBuffered
+		}{tracer, aad, named, digester, decoder}
+	case optAsync | optCipher | optKeyDigest | optBuffered:
+		return struct {
+			*tracingDelegate
+			tracingAsync
+			tracingCipher
+			tracingKeyDigest
+			tracingBuffered
+		}{tracer, async, named, digester, decoder}
+	case optAAD | optAsync | optCipher | optKeyDigest | optBuffered:
+		return struct {
+			*tracingDelegate
+			tracingAAD
+			tracingAsync
+			tracingCipher
+			tracingKeyDigest
+			tracingBuffered
+		}{tracer, aad, async, named, digester, decoder}
+	}
+	return tracer
+}
@@ -54,6 +54,10 @@ type MessageEnvelope struct {
 	_sender ID
 	_receiver ID
 	_time Time
+
+	_group ID
+	_groupRaw interface{}  // value of 'group' when parsed, see rawMatch()
+	_groupLoaded bool
 }
 
 func NewEnvelope(dict map[string]interface{}, from ID, to ID, when Time) Envelope {
@@ -81,6 +85,8 @@ func (env *MessageEnvelope) Init(dict map[string]interface{}) Envelope {
 		env._sender = nil
 		env._receiver = nil
 		env._time = TimeNil()
+		env._group = nil
+		env._groupLoaded = false
 	}
 	return env
 }
@@ -121,11 +127,42 @@ func (env *MessageEnvelope) Time() Time {
  *  the group ID will be saved as 'group'.
  */
 func (env *MessageEnvelope) Group() ID {
-	return EnvelopeGetGroup(env.Map())
+	raw := env.Get("group")
+	if !env._groupLoaded || !rawMatch(env._groupRaw, raw) {
+		// absent 'group' is cached too, until it's written
+		env._group = EnvelopeGetGroup(env.Map())
+		env._groupRaw = raw
+		env._groupLoaded = true
+	}
+	return env._group
 }
 
 func (env *MessageEnvelope) SetGroup(group ID)  {
 	EnvelopeSetGroup(env.Map(), group)
+	env._group = group
+	env._groupRaw = env.Get("group")
+	env._groupLoaded = true
+}
+
+/**
+ *  Check whether the raw value of a cached field is unchanged,
+ *  so writes to the map (Set, Remove, or directly) drop the cache
+ *
+ * @param cached - raw value when parsed
+ * @param raw    - current value in map
+ * @return false when changed, or not comparable
+ */
+func rawMatch(cached interface{}, raw interface{}) bool {
+	if raw == nil {
+		return cached == nil
+	}
+	text, ok := raw.(string)
+	if !ok {
+		// ID or map, parse again
+		return false
+	}
+	old, ok := cached.(string)
+	return ok && old == text
 }
 
 /*
@@ -143,3 +180,42 @@ func (env *MessageEnvelope) Type() ContentType {
 func (env *MessageEnvelope) SetType(msgType ContentType)  {
 	EnvelopeSetType(env.Map(), msgType)
 }
+
+/*
+ *  Scheduled Message
+ *  ~~~~~~~~~~~~~~~~~
+ *  the message should not be delivered before this time
+ */
+func (env *MessageEnvelope) SendAfter() Time {
+	return EnvelopeGetSendAfter(env.Map())
+}
+
+func (env *MessageEnvelope) SetSendAfter(when Time) {
+	EnvelopeSetSendAfter(env.Map(), when)
+}
+
+/*
+ *  No Acknowledgement
+ *  ~~~~~~~~~~~~~~~~~~
+ *  hint for the receiver not to respond receipts
+ */
+func (env *MessageEnvelope) NoAck() bool {
+	return EnvelopeGetNoAck(env.Map())
+}
+
+func (env *MessageEnvelope) SetNoAck(flag bool) {
+	EnvelopeSetNoAck(env.Map(), flag)
+}
+
+/*
+ *  Carbon Copy Receivers
+ *  ~~~~~~~~~~~~~~~~~~~~~
+ *  other direct recipients of this personal message
+ */
+func (env *MessageEnvelope) Receivers() []ID {
+	return EnvelopeGetReceivers(env.Map())
+}
+
+func (env *MessageEnvelope) SetReceivers(receivers []ID) {
+	EnvelopeSetReceivers(env.Map(), receivers)
+}
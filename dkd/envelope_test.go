@@ -0,0 +1,90 @@
+/* license: https://mit-license.org
+ *
+ *  Dao-Ke-Dao: Universal Message Module
+ *
+ *                                Written in 2022 by Moky <albert.moky@gmail.com>
+ *
+ * ==============================================================================
+ * The MIT License (MIT)
+ *
+ * Copyright (c) 2022 Albert Moky
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ * ==============================================================================
+ */
+package dkd_test
+
+import (
+	"testing"
+	. "github.com/dimchat/dkd-go/protocol"
+	. "github.com/dimchat/mkm-go/protocol"
+	. "github.com/dimchat/mkm-go/types"
+)
+
+func TestEnvelopeGroupCache(t *testing.T) {
+	setup()
+	env := EnvelopeCreate(IDParse("alice@a1"), IDParse("bob@b1"), TimeNow())
+	if env.Group() != nil {
+		t.Fatal("unexpected group")
+	}
+	env.Set("group", "group@g1")
+	if group := env.Group(); group == nil || group.String() != "group@g1" {
+		t.Fatalf("group not reloaded after Set: %v", group)
+	}
+	env.Map()["group"] = "group@g2"
+	if group := env.Group(); group == nil || group.String() != "group@g2" {
+		t.Fatalf("group not reloaded after map write: %v", group)
+	}
+	env.Remove("group")
+	if env.Group() != nil {
+		t.Fatal("group not cleared after Remove")
+	}
+}
+
+func BenchmarkEnvelopeGroupAbsent(b *testing.B) {
+	setup()
+	env := EnvelopeCreate(IDParse("alice@a1"), IDParse("bob@b1"), TimeNow())
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		env.Group()
+	}
+}
+
+func BenchmarkEnvelopeGroup(b *testing.B) {
+	setup()
+	env := EnvelopeCreate(IDParse("alice@a1"), IDParse("bob@b1"), TimeNow())
+	env.Set("group", "group@g1")
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		env.Group()
+	}
+}
+
+func BenchmarkContentGroup(b *testing.B) {
+	setup()
+	content := textContent("hello")
+	content.Set("group", "group@g1")
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		content.Group()
+	}
+}
@@ -0,0 +1,138 @@
+/* license: https://mit-license.org
+ *
+ *  Dao-Ke-Dao: Universal Message Module
+ *
+ *                                Written in 2022 by Moky <albert.moky@gmail.com>
+ *
+ * ==============================================================================
+ * The MIT License (MIT)
+ *
+ * Copyright (c) 2022 Albert Moky
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ * ==============================================================================
+ */
+package dkd
+
+import (
+	"fmt"
+	"sync"
+	. "github.com/dimchat/dkd-go/protocol"
+	. "github.com/dimchat/mkm-go/crypto"
+	. "github.com/dimchat/mkm-go/protocol"
+)
+
+/**
+ *  Trace of Transform
+ *  ~~~~~~~~~~~~~~~~~~
+ *  Steps of delegate calls, for debugging integration failures
+ */
+type Trace struct {
+	Steps []TraceStep
+	Error error  // panic in transform
+
+	_lock sync.Mutex
+}
+
+type TraceStep = DelegateCall
+
+//-------- IDelegateHooks
+
+func (trace *Trace) OnCall(call *DelegateCall) {
+	trace._lock.Lock()
+	defer trace._lock.Unlock()
+	trace.Steps = append(trace.Steps, *call)
+}
+
+func (trace *Trace) String() string {
+	trace._lock.Lock()
+	defer trace._lock.Unlock()
+	text := ""
+	for index, step := range trace.Steps {
+		text += fmt.Sprintf("%d. %s in=%d out=%d %v", index + 1, step.Method,
+			step.InputSize, step.OutputSize, step.Duration)
+		if step.Nil {
+			text += " (nil)"
+		}
+		text += "\n"
+	}
+	if trace.Error != nil {
+		text += fmt.Sprintf("error: %v\n", trace.Error)
+	}
+	return text
+}
+
+/**
+ *  Encrypt with trace
+ *
+ * @param iMsg     - instant message with delegate
+ * @param password - symmetric key
+ * @param members  - group members; nil for personal message
+ * @return SecureMessage and trace
+ */
+func ExplainEncrypt(iMsg InstantMessage, password SymmetricKey, members []ID) (sMsg SecureMessage, trace *Trace) {
+	trace = new(Trace)
+	delegate := iMsg.Delegate()
+	if delegate == nil {
+		trace.Error = ErrDelegateNotSet
+		return nil, trace
+	}
+	iMsg.SetDelegate(WrapDelegate(delegate, trace))
+	defer func() {
+		iMsg.SetDelegate(delegate)
+		if sMsg != nil {
+			// the tracer was propagated to the result, restore it too
+			sMsg.SetDelegate(delegate)
+		}
+		if r := recover(); r != nil {
+			trace.Error = fmt.Errorf("%v", r)
+		}
+	}()
+	sMsg = iMsg.Encrypt(password, members)
+	return sMsg, trace
+}
+
+/**
+ *  Decrypt with trace
+ *
+ * @param sMsg - secure message with delegate
+ * @return InstantMessage and trace
+ */
+func ExplainDecrypt(sMsg SecureMessage) (iMsg InstantMessage, trace *Trace) {
+	trace = new(Trace)
+	delegate := sMsg.Delegate()
+	if delegate == nil {
+		trace.Error = ErrDelegateNotSet
+		return nil, trace
+	}
+	sMsg.SetDelegate(WrapDelegate(delegate, trace))
+	defer func() {
+		sMsg.SetDelegate(delegate)
+		if iMsg != nil {
+			// the tracer was propagated to the result, restore it too
+			iMsg.SetDelegate(delegate)
+		}
+		if r := recover(); r != nil {
+			trace.Error = fmt.Errorf("%v", r)
+		}
+	}()
+	iMsg = sMsg.Decrypt()
+	return iMsg, trace
+}
+
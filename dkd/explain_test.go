@@ -0,0 +1,104 @@
+/* license: https://mit-license.org
+ *
+ *  Dao-Ke-Dao: Universal Message Module
+ *
+ *                                Written in 2022 by Moky <albert.moky@gmail.com>
+ *
+ * ==============================================================================
+ * The MIT License (MIT)
+ *
+ * Copyright (c) 2022 Albert Moky
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ * ==============================================================================
+ */
+package dkd_test
+
+import (
+	"testing"
+	"github.com/dimchat/dkd-go/dkd/sim"
+	. "github.com/dimchat/dkd-go/dkd"
+	. "github.com/dimchat/dkd-go/protocol"
+	. "github.com/dimchat/mkm-go/crypto"
+	. "github.com/dimchat/mkm-go/types"
+)
+
+type namedPeer struct {
+	*sim.Peer
+}
+
+func (peer *namedPeer) ContentCipher(_ SymmetricKey, _ InstantMessage) string {
+	return "XOR"
+}
+
+func TestExplainEncryptForwardsOptional(t *testing.T) {
+	alice, bob := &namedPeer{newPeer("alice@a1")}, newPeer("bob@b1")
+	env := EnvelopeCreate(alice.ID(), bob.ID(), TimeNow())
+	iMsg := NewInstantMessage(nil, env, textContent("hello"))
+	iMsg.SetDelegate(alice)
+
+	sMsg, trace := ExplainEncrypt(iMsg, new(testCrypto).GenerateKey(), nil)
+	if sMsg == nil {
+		t.Fatalf("failed to encrypt: %v", trace.Error)
+	}
+	if sMsg.Get("cipher") != "XOR" {
+		t.Fatalf("cipher not forwarded: %s", snapshot(sMsg.Map()))
+	}
+	found := false
+	for _, step := range trace.Steps {
+		found = found || step.Method == "ContentCipher"
+	}
+	if !found {
+		t.Fatalf("ContentCipher not traced:\n%s", trace)
+	}
+	if sMsg.Delegate() != alice || iMsg.Delegate() != alice {
+		t.Fatal("delegate not restored")
+	}
+}
+
+func TestExplainDecryptRestoresDelegate(t *testing.T) {
+	alice, bob := newPeer("alice@a1"), newPeer("bob@b1")
+	env := EnvelopeCreate(alice.ID(), bob.ID(), TimeNow())
+	iMsg := NewInstantMessage(nil, env, textContent("hello"))
+	iMsg.SetDelegate(alice)
+	sMsg := iMsg.Encrypt(new(testCrypto).GenerateKey(), nil)
+	sMsg.SetDelegate(bob)
+
+	decrypted, trace := ExplainDecrypt(sMsg)
+	if decrypted == nil {
+		t.Fatalf("failed to decrypt: %v", trace.Error)
+	}
+	if decrypted.Delegate() != bob || sMsg.Delegate() != bob {
+		t.Fatal("delegate not restored")
+	}
+}
+
+func TestWrapDelegateOptionalInterfaces(t *testing.T) {
+	plain, named := newPeer("alice@a1"), &namedPeer{newPeer("bob@b1")}
+	wrapped := WrapDelegate(plain, new(Trace))
+	if _, ok := wrapped.(CipherDelegate); ok {
+		t.Fatal("wrapper claims CipherDelegate for a plain delegate")
+	}
+	if _, ok := wrapped.(AsyncDelegate); ok {
+		t.Fatal("wrapper claims AsyncDelegate for a plain delegate")
+	}
+	if _, ok := WrapDelegate(named, new(Trace)).(CipherDelegate); !ok {
+		t.Fatal("optional interface not forwarded")
+	}
+}
@@ -0,0 +1,150 @@
+/* license: https://mit-license.org
+ *
+ *  Dao-Ke-Dao: Universal Message Module
+ *
+ *                                Written in 2022 by Moky <albert.moky@gmail.com>
+ *
+ * ==============================================================================
+ * The MIT License (MIT)
+ *
+ * Copyright (c) 2022 Albert Moky
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ * ==============================================================================
+ */
+package dkd
+
+import (
+	"bufio"
+	"io"
+	. "github.com/dimchat/dkd-go/protocol"
+	. "github.com/dimchat/mkm-go/protocol"
+	. "github.com/dimchat/mkm-go/types"
+)
+
+/**
+ *  Message Iterator
+ *  ~~~~~~~~~~~~~~~~
+ */
+type MessageIterator interface {
+
+	// return nil when no more messages
+	Next() ReliableMessage
+}
+
+/**
+ *  Message Filter
+ *  ~~~~~~~~~~~~~~
+ *  Empty fields match all messages
+ */
+type Filter struct {
+	Sender ID
+	Since  Time  // inclusive
+	Until  Time  // exclusive
+	Types  []ContentType
+}
+
+func (filter *Filter) Match(rMsg ReliableMessage) bool {
+	if filter == nil {
+		return true
+	}
+	if filter.Sender != nil && !filter.Sender.Equal(rMsg.Sender()) {
+		return false
+	}
+	when := rMsg.Time()
+	if !TimeIsNil(filter.Since) && (TimeIsNil(when) || when.UnixNano() < filter.Since.UnixNano()) {
+		return false
+	}
+	if !TimeIsNil(filter.Until) && (TimeIsNil(when) || when.UnixNano() >= filter.Until.UnixNano()) {
+		return false
+	}
+	if len(filter.Types) > 0 {
+		msgType := rMsg.Type()
+		for _, item := range filter.Types {
+			if item == msgType {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+/**
+ *  Export messages as NDJSON (one JsON object per line)
+ *
+ * @param writer - output stream
+ * @param it     - messages
+ * @param filter - message filter; nil for all
+ * @return count of exported messages
+ */
+func ExportStream(writer io.Writer, it MessageIterator, filter *Filter) (int, error) {
+	count := 0
+	for rMsg := it.Next(); rMsg != nil; rMsg = it.Next() {
+		if !filter.Match(rMsg) {
+			continue
+		}
+		// byte-stable output for reproducible archives
+		line, err := CanonicalJSON(rMsg.Map())
+		if err != nil {
+			return count, err
+		}
+		if _, err = writer.Write(append(line, '\n')); err != nil {
+			return count, err
+		}
+		count++
+	}
+	return count, nil
+}
+
+/**
+ *  Import messages from NDJSON stream
+ *
+ * @param reader  - input stream
+ * @param filter  - message filter; nil for all
+ * @param handler - callback for each message
+ * @return count of imported messages
+ */
+func ImportStream(reader io.Reader, filter *Filter, handler func(rMsg ReliableMessage)) (int, error) {
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 0, 64 * 1024), 16 * 1024 * 1024)
+	count := 0
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+		// keep 'sn'/'time' as json.Number, float64 loses precision
+		object, err := JSONDecodeNumbers(string(line))
+		if err != nil {
+			return count, err
+		}
+		info, ok := object.(map[string]interface{})
+		if !ok {
+			return count, ErrMessageMalformed
+		}
+		rMsg := ReliableMessageParse(info)
+		if rMsg == nil || !filter.Match(rMsg) {
+			continue
+		}
+		handler(rMsg)
+		count++
+	}
+	return count, scanner.Err()
+}
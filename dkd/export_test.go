@@ -0,0 +1,59 @@
+/* license: https://mit-license.org
+ *
+ *  Dao-Ke-Dao: Universal Message Module
+ *
+ *                                Written in 2022 by Moky <albert.moky@gmail.com>
+ *
+ * ==============================================================================
+ * The MIT License (MIT)
+ *
+ * Copyright (c) 2022 Albert Moky
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ * ==============================================================================
+ */
+package dkd_test
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	. "github.com/dimchat/dkd-go/dkd"
+	. "github.com/dimchat/dkd-go/protocol"
+)
+
+func TestImportStreamKeepsNumbers(t *testing.T) {
+	good, _ := receivedMessages(t)
+	info := good.CopyMap(false)
+	info["sn"] = uint64(18446744073709551615)
+	line, err := CanonicalJSON(info)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var imported []ReliableMessage
+	count, err := ImportStream(strings.NewReader(string(line) + "\n"), nil, func(rMsg ReliableMessage) {
+		imported = append(imported, rMsg)
+	})
+	if err != nil || count != 1 {
+		t.Fatalf("failed to import: %d, %v", count, err)
+	}
+	if sn, _ := imported[0].Get("sn").(json.Number); sn != "18446744073709551615" {
+		t.Fatalf("number not preserved: %v", imported[0].Get("sn"))
+	}
+}
@@ -75,6 +75,10 @@ func (factory *PlainMessageFactory) Init() InstantMessageFactory {
 //-------- IInstantMessageFactory
 
 func (factory *PlainMessageFactory) GenerateSerialNumber(_ ContentType, _ Time) uint64 {
+	return randomSerialNumber()
+}
+
+func randomSerialNumber() uint64 {
 	// because we must make sure all messages in a same chat box won't have
 	// same serial numbers, so we can't use time-related numbers, therefore
 	// the best choice is a totally random number, maybe.
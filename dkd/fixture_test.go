@@ -0,0 +1,173 @@
+/* license: https://mit-license.org
+ *
+ *  Dao-Ke-Dao: Universal Message Module
+ *
+ *                                Written in 2022 by Moky <albert.moky@gmail.com>
+ *
+ * ==============================================================================
+ * The MIT License (MIT)
+ *
+ * Copyright (c) 2022 Albert Moky
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ * ==============================================================================
+ */
+package dkd_test
+
+import (
+	"bytes"
+	"strings"
+	"sync"
+	. "github.com/dimchat/dkd-go/dkd"
+	"github.com/dimchat/dkd-go/dkd/sim"
+	. "github.com/dimchat/dkd-go/protocol"
+	. "github.com/dimchat/mkm-go/crypto"
+	"github.com/dimchat/mkm-go/mkm"
+	. "github.com/dimchat/mkm-go/protocol"
+	. "github.com/dimchat/mkm-go/types"
+)
+
+//
+//  Test fixtures: ID/content factories and a fake crypto,
+//  addresses starting with 'g' are groups
+//
+
+type testAddress struct {
+	mkm.BaseAddress
+}
+
+func (address *testAddress) IsBroadcast() bool {
+	return false
+}
+
+type testContentFactory struct {}
+
+func (factory *testContentFactory) ParseContent(content map[string]interface{}) Content {
+	return new(BaseContent).Init(content)
+}
+
+var setupOnce sync.Once
+
+func setup() {
+	setupOnce.Do(func() {
+		mkm.BuildGeneralIDFactory()
+		AddressSetFactory(new(mkm.GeneralAddressFactory).Init(func(address string) Address {
+			network := MAIN
+			if strings.HasPrefix(address, "g") {
+				network = GROUP
+			}
+			addr := new(testAddress)
+			addr.Init(address, network)
+			return addr
+		}))
+		if ContentGetFactory(0) == nil {
+			ContentSetFactory(0, new(testContentFactory))
+		}
+	})
+}
+
+// XOR key, only for tests
+type testKey struct {
+	Dictionary
+}
+
+func (key *testKey) Algorithm() string {
+	return "XOR"
+}
+
+func (key *testKey) Data() []byte {
+	data, _ := key.Get("data").(string)
+	return []byte(data)
+}
+
+func (key *testKey) Encrypt(plaintext []byte) []byte {
+	mask := key.Data()[0]
+	out := make([]byte, len(plaintext))
+	for index, ch := range plaintext {
+		out[index] = ch ^ mask
+	}
+	return out
+}
+
+func (key *testKey) Decrypt(ciphertext []byte) []byte {
+	return key.Encrypt(ciphertext)
+}
+
+func (key *testKey) Match(_ EncryptKey) bool {
+	return true
+}
+
+// "key pairs": encrypted key = receiver + '|' + key, signature = sender padded to 64 bytes
+type testCrypto struct {
+	_count int
+}
+
+func (crypto *testCrypto) GenerateKey() SymmetricKey {
+	crypto._count++
+	return crypto.ParseKey(map[string]interface{}{
+		"algorithm": "XOR",
+		"data": string(rune('A' + crypto._count % 26)),
+	})
+}
+
+func (crypto *testCrypto) ParseKey(info map[string]interface{}) SymmetricKey {
+	key := new(testKey)
+	key.Init(info)
+	return key
+}
+
+func (crypto *testCrypto) EncryptKey(data []byte, receiver ID) []byte {
+	return append([]byte(receiver.String() + "|"), data...)
+}
+
+func (crypto *testCrypto) DecryptKey(data []byte, receiver ID) []byte {
+	prefix := []byte(receiver.String() + "|")
+	if !bytes.HasPrefix(data, prefix) {
+		return nil
+	}
+	return data[len(prefix):]
+}
+
+func (crypto *testCrypto) Sign(data []byte, sender ID) []byte {
+	signature := bytes.Repeat([]byte(sender.String()), 64)[:63]
+	return append(signature, byte(len(data)))
+}
+
+func (crypto *testCrypto) Verify(data []byte, signature []byte, sender ID) bool {
+	return SignatureEqual(crypto.Sign(data, sender), signature)
+}
+
+func newPeer(identifier string) *sim.Peer {
+	setup()
+	return sim.NewPeer(IDParse(identifier), new(testCrypto))
+}
+
+func textContent(text string) Content {
+	content := new(BaseContent).InitWithType(TEXT)
+	content.Set("text", text)
+	return content
+}
+
+func snapshot(dict map[string]interface{}) string {
+	blob, err := CanonicalJSON(dict)
+	if err != nil {
+		panic(err)
+	}
+	return string(blob)
+}
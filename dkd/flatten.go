@@ -0,0 +1,117 @@
+/* license: https://mit-license.org
+ *
+ *  Dao-Ke-Dao: Universal Message Module
+ *
+ *                                Written in 2022 by Moky <albert.moky@gmail.com>
+ *
+ * ==============================================================================
+ * The MIT License (MIT)
+ *
+ * Copyright (c) 2022 Albert Moky
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ * ==============================================================================
+ */
+package dkd
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	. "github.com/dimchat/dkd-go/protocol"
+	. "github.com/dimchat/mkm-go/digest"
+	. "github.com/dimchat/mkm-go/types"
+)
+
+/**
+ *  Row View
+ *  ~~~~~~~~
+ *  Scalar columns of a reliable message for storage layers,
+ *  the content (with its 'sn') is encrypted, so it's not here.
+ *
+ *      sender      - sender ID
+ *      receiver    - receiver ID
+ *      group       - group ID; empty for personal message
+ *      type        - content type in envelope; 0 if not set
+ *      time        - timestamp in seconds
+ *      size        - length of blob
+ *      fingerprint - hex(sha256(signature))
+ *      blob        - JsON of the whole message
+ */
+type RowView struct {
+	Sender      string
+	Receiver    string
+	Group       string
+	Type        uint8
+	Time        float64
+	Size        int
+	Fingerprint string
+	Blob        []byte
+}
+
+func Flatten(rMsg ReliableMessage) RowView {
+	blob, err := json.Marshal(rMsg.Map())
+	if err != nil {
+		panic(err)
+	}
+	row := RowView{
+		Sender:      rMsg.Sender().String(),
+		Receiver:    rMsg.Receiver().String(),
+		Type:        uint8(rMsg.Type()),
+		Size:        len(blob),
+		Fingerprint: MessageFingerprint(rMsg),
+		Blob:        blob,
+	}
+	if group := rMsg.Group(); group != nil {
+		row.Group = group.String()
+	}
+	if when := rMsg.Time(); !TimeIsNil(when) {
+		row.Time = TimeToFloat64(when)
+	}
+	return row
+}
+
+func Unflatten(row RowView) ReliableMessage {
+	var info map[string]interface{}
+	if err := json.Unmarshal(row.Blob, &info); err != nil {
+		return nil
+	}
+	return ReliableMessageParse(info)
+}
+
+/**
+ *  Get message fingerprint
+ *
+ * @param rMsg - reliable message
+ * @return hex(sha256(signature))
+ */
+func MessageFingerprint(rMsg ReliableMessage) string {
+	signature, _ := rMsg.Get("signature").(string)
+	return hex.EncodeToString(SHA256([]byte(signature)))
+}
+
+/**
+ *  Get fingerprint of the key: hex(sha256(canonical JSON of key info))
+ */
+func KeyFingerprint(key Mapper) string {
+	blob, err := CanonicalJSON(key.Map())
+	if err != nil {
+		return ""
+	}
+	return hex.EncodeToString(SHA256(blob))
+}
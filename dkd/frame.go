@@ -0,0 +1,278 @@
+/* license: https://mit-license.org
+ *
+ *  Dao-Ke-Dao: Universal Message Module
+ *
+ *                                Written in 2022 by Moky <albert.moky@gmail.com>
+ *
+ * ==============================================================================
+ * The MIT License (MIT)
+ *
+ * Copyright (c) 2022 Albert Moky
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ * ==============================================================================
+ */
+package dkd
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	. "github.com/dimchat/dkd-go/protocol"
+	. "github.com/dimchat/mkm-go/format"
+)
+
+var ErrFrameMalformed = errors.New("message frame malformed")
+
+/**
+ *  Frame Format
+ *  ~~~~~~~~~~~~
+ *  How a reliable message is serialized on a connection:
+ *
+ *      FrameJSON   - plain JsON, 'data' encoded in base64
+ *      FrameHybrid - binary frame, the raw 'data' follows a JsON header:
+ *
+ *          +---------------+----------+----------+------+------+
+ *          | 00 'D' 'K' 01 | head len | body len | head | body |
+ *          +---------------+----------+----------+------+------+
+ *           magic          uint32     uint32 (big-endian)
+ *
+ *  JsON text never starts with 0x00, so both formats can be read
+ *  from the same connection without negotiation.
+ */
+type FrameFormat uint8
+
+const (
+	FrameJSON   FrameFormat = 0
+	FrameHybrid FrameFormat = 1
+)
+
+var frameMagic = []byte{0x00, 'D', 'K', 0x01}
+
+const frameHeadSize = 12  // magic + head len + body len
+
+/**
+ *  Frame Codec
+ *  ~~~~~~~~~~~
+ *  Encodes in the format chosen for the connection,
+ *  decodes both formats transparently.
+ */
+type FrameCodec struct {
+
+	_format FrameFormat
+	_limits Limits
+}
+
+func NewFrameCodec(format FrameFormat) *FrameCodec {
+	codec := new(FrameCodec)
+	codec.Init(format)
+	return codec
+}
+
+func (codec *FrameCodec) Init(format FrameFormat) *FrameCodec {
+	codec._format = format
+	codec._limits = DefaultLimits()
+	return codec
+}
+
+func (codec *FrameCodec) Format() FrameFormat {
+	return codec._format
+}
+
+/**
+ *  Switch format when the peer's capability is known
+ *
+ * @param binarySupported - whether the peer accepts hybrid frames
+ */
+func (codec *FrameCodec) SetBinarySupported(binarySupported bool) {
+	if binarySupported {
+		codec._format = FrameHybrid
+	} else {
+		codec._format = FrameJSON
+	}
+}
+
+func (codec *FrameCodec) SetLimits(limits Limits) {
+	codec._limits = limits
+}
+
+func (codec *FrameCodec) Encode(rMsg ReliableMessage) ([]byte, error) {
+	if codec._format == FrameHybrid {
+		return EncodeHybridFrame(rMsg)
+	}
+	return CanonicalJSON(rMsg.Map())
+}
+
+func (codec *FrameCodec) Decode(frame []byte) (ReliableMessage, error) {
+	if !IsHybridFrame(frame) {
+		return ParseReliableMessageReader(bytes.NewReader(frame), codec._limits)
+	}
+	return DecodeHybridFrame(frame, codec._limits)
+}
+
+/**
+ *  Write one frame to the stream
+ */
+func (codec *FrameCodec) WriteFrame(writer io.Writer, rMsg ReliableMessage) error {
+	frame, err := codec.Encode(rMsg)
+	if err != nil {
+		return err
+	}
+	if codec._format == FrameJSON {
+		// NDJSON
+		frame = append(frame, '\n')
+	}
+	_, err = writer.Write(frame)
+	return err
+}
+
+/**
+ *  Read one frame from the stream, JsON frames must end with '\n';
+ *  after ErrMessageTooLarge the stream is out of sync, close it
+ */
+func (codec *FrameCodec) ReadFrame(reader *bufio.Reader) (ReliableMessage, error) {
+	magic, err := reader.Peek(len(frameMagic))
+	if err != nil && !(err == io.EOF && len(magic) > 0) {
+		return nil, err
+	}
+	if !IsHybridFrame(magic) {
+		line, err := readLine(reader, codec._limits.MaxSize)
+		if err != nil {
+			return nil, err
+		}
+		return codec.Decode(line)
+	}
+	head := make([]byte, frameHeadSize)
+	if _, err = io.ReadFull(reader, head); err != nil {
+		return nil, err
+	}
+	headLen := binary.BigEndian.Uint32(head[4:8])
+	bodyLen := binary.BigEndian.Uint32(head[8:12])
+	total := int64(frameHeadSize) + int64(headLen) + int64(bodyLen)
+	if codec._limits.MaxSize > 0 && total > codec._limits.MaxSize {
+		return nil, ErrMessageTooLarge
+	}
+	frame := make([]byte, total)
+	copy(frame, head)
+	if _, err = io.ReadFull(reader, frame[frameHeadSize:]); err != nil {
+		return nil, err
+	}
+	return DecodeHybridFrame(frame, codec._limits)
+}
+
+// read a line (with '\n'), fail as soon as it exceeds max bytes (0 for no limit)
+func readLine(reader *bufio.Reader, max int64) ([]byte, error) {
+	var line []byte
+	for {
+		chunk, err := reader.ReadSlice('\n')
+		if max > 0 && int64(len(line) + len(chunk)) > max + 1 {
+			return nil, ErrMessageTooLarge
+		}
+		line = append(line, chunk...)
+		if err == bufio.ErrBufferFull {
+			continue
+		} else if err != nil && !(err == io.EOF && len(line) > 0) {
+			return nil, err
+		}
+		return line, nil
+	}
+}
+
+func IsHybridFrame(frame []byte) bool {
+	return len(frame) >= len(frameMagic) && bytes.Equal(frame[:len(frameMagic)], frameMagic)
+}
+
+/**
+ *  Convert reliable message to hybrid frame
+ *
+ * @param rMsg - message with base64 'data'
+ * @return frame with raw data body
+ */
+func EncodeHybridFrame(rMsg ReliableMessage) ([]byte, error) {
+	info := rMsg.Map()
+	b64, _ := info["data"].(string)
+	if b64 == "" {
+		return nil, ErrFrameMalformed
+	}
+	body := Base64Decode(b64)
+	if body == nil {
+		return nil, ErrFrameMalformed
+	}
+	header := make(map[string]interface{}, len(info))
+	for key, value := range info {
+		if key != "data" {
+			header[key] = value
+		}
+	}
+	head, err := CanonicalJSON(header)
+	if err != nil {
+		return nil, err
+	}
+	frame := make([]byte, frameHeadSize, frameHeadSize + len(head) + len(body))
+	copy(frame, frameMagic)
+	binary.BigEndian.PutUint32(frame[4:8], uint32(len(head)))
+	binary.BigEndian.PutUint32(frame[8:12], uint32(len(body)))
+	frame = append(frame, head...)
+	frame = append(frame, body...)
+	return frame, nil
+}
+
+/**
+ *  Convert hybrid frame back to reliable message
+ *
+ * @param frame  - whole frame
+ * @param limits - size caps for the frame and the JsON header
+ * @return message with base64 'data'
+ */
+func DecodeHybridFrame(frame []byte, limits Limits) (ReliableMessage, error) {
+	if !IsHybridFrame(frame) || len(frame) < frameHeadSize {
+		return nil, ErrFrameMalformed
+	}
+	if limits.MaxSize > 0 && int64(len(frame)) > limits.MaxSize {
+		return nil, ErrMessageTooLarge
+	}
+	headLen := int64(binary.BigEndian.Uint32(frame[4:8]))
+	bodyLen := int64(binary.BigEndian.Uint32(frame[8:12]))
+	if int64(frameHeadSize) + headLen + bodyLen != int64(len(frame)) {
+		return nil, ErrFrameMalformed
+	}
+	head := frame[frameHeadSize:frameHeadSize + headLen]
+	body := frame[frameHeadSize + headLen:]
+	parser := newLimitedParser(bytes.NewReader(head), limits)
+	info, err := parser.root()
+	if err == ErrMessageMalformed || err == io.EOF || err == io.ErrUnexpectedEOF {
+		return nil, ErrFrameMalformed
+	} else if err != nil {
+		return nil, err
+	} else if !parser.finished() {
+		// trailing data after the header
+		return nil, ErrFrameMalformed
+	}
+	if _, exists := info["data"]; exists {
+		return nil, ErrFrameMalformed
+	}
+	info["data"] = Base64Encode(body)
+	rMsg := ReliableMessageParse(info)
+	if rMsg == nil {
+		return nil, ErrMessageMalformed
+	}
+	return rMsg, nil
+}
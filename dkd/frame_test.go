@@ -0,0 +1,74 @@
+/* license: https://mit-license.org
+ *
+ *  Dao-Ke-Dao: Universal Message Module
+ *
+ *                                Written in 2022 by Moky <albert.moky@gmail.com>
+ *
+ * ==============================================================================
+ * The MIT License (MIT)
+ *
+ * Copyright (c) 2022 Albert Moky
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ * ==============================================================================
+ */
+package dkd_test
+
+import (
+	"bufio"
+	"strings"
+	"testing"
+	. "github.com/dimchat/dkd-go/dkd"
+	. "github.com/dimchat/dkd-go/protocol"
+	. "github.com/dimchat/mkm-go/types"
+)
+
+func TestReadFrameLineLimit(t *testing.T) {
+	codec := NewFrameCodec(FrameJSON)
+	codec.SetLimits(Limits{MaxSize: 64})
+	stream := strings.NewReader(strings.Repeat("x", 1 << 20))
+	if _, err := codec.ReadFrame(bufio.NewReaderSize(stream, 16)); err != ErrMessageTooLarge {
+		t.Fatalf("expected ErrMessageTooLarge, got %v", err)
+	}
+}
+
+func TestHybridHeaderLimits(t *testing.T) {
+	alice, bob := newPeer("alice@a1"), newPeer("bob@b1")
+	env := EnvelopeCreate(alice.ID(), bob.ID(), TimeNow())
+	iMsg := NewInstantMessage(nil, env, textContent("hello"))
+	iMsg.SetDelegate(alice)
+	info := iMsg.Encrypt(new(testCrypto).GenerateKey(), nil).Sign().CopyMap(false)
+	var nested interface{} = "deep"
+	for i := 0; i < 8; i++ {
+		nested = []interface{}{nested}
+	}
+	info["extra"] = nested
+	frame, err := EncodeHybridFrame(ReliableMessageParse(info))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = DecodeHybridFrame(frame, DefaultLimits()); err != nil {
+		t.Fatalf("failed to decode: %v", err)
+	}
+	limits := DefaultLimits()
+	limits.MaxDepth = 4
+	if _, err = DecodeHybridFrame(frame, limits); err != ErrNestingTooDeep {
+		t.Fatalf("expected ErrNestingTooDeep, got %v", err)
+	}
+}
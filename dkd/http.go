@@ -0,0 +1,367 @@
+/* license: https://mit-license.org
+ *
+ *  Dao-Ke-Dao: Universal Message Module
+ *
+ *                                Written in 2022 by Moky <albert.moky@gmail.com>
+ *
+ * ==============================================================================
+ * The MIT License (MIT)
+ *
+ * Copyright (c) 2022 Albert Moky
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ * ==============================================================================
+ */
+package dkd
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+	. "github.com/dimchat/dkd-go/protocol"
+)
+
+var ErrTooManyMessages = errors.New("too many messages in one request")
+
+const (
+	MediaTypeJSON   = "application/json"
+	MediaTypeNDJSON = "application/x-ndjson"
+	MediaTypeFrame  = "application/vnd.dim.frame"  // hybrid frames, see FrameCodec
+
+	HeaderIdempotencyKey = "Idempotency-Key"
+)
+
+/**
+ *  Message Sink
+ *  ~~~~~~~~~~~~
+ *  Receives messages posted over HTTP
+ */
+type MessageSink interface {
+
+	Deliver(rMsg ReliableMessage) error
+}
+
+/**
+ *  Fingerprint Set
+ *  ~~~~~~~~~~~~~~~
+ *  For idempotent posting, a message already delivered is skipped
+ */
+type FingerprintSet interface {
+
+	// return false when the fingerprint was remembered before
+	Remember(fingerprint string) bool
+}
+
+/**
+ *  Recent Fingerprints
+ *  ~~~~~~~~~~~~~~~~~~~
+ *  In-memory fingerprint set, entries expire after TTL
+ */
+type RecentFingerprints struct {
+	_ttl time.Duration
+	_seen map[string]time.Time
+	_lock sync.Mutex
+}
+
+func NewRecentFingerprints(ttl time.Duration) *RecentFingerprints {
+	set := new(RecentFingerprints)
+	set.Init(ttl)
+	return set
+}
+
+func (set *RecentFingerprints) Init(ttl time.Duration) *RecentFingerprints {
+	set._ttl = ttl
+	set._seen = make(map[string]time.Time)
+	return set
+}
+
+//-------- IFingerprintSet
+
+func (set *RecentFingerprints) Remember(fingerprint string) bool {
+	now := time.Now()
+	set._lock.Lock()
+	defer set._lock.Unlock()
+	if last, ok := set._seen[fingerprint]; ok && now.Sub(last) < set._ttl {
+		return false
+	}
+	set._seen[fingerprint] = now
+	return true
+}
+
+/**
+ *  Remove expired fingerprints
+ *
+ * @return count of removed entries
+ */
+func (set *RecentFingerprints) Purge(now time.Time) int {
+	set._lock.Lock()
+	defer set._lock.Unlock()
+	count := 0
+	for fingerprint, last := range set._seen {
+		if now.Sub(last) >= set._ttl {
+			delete(set._seen, fingerprint)
+			count++
+		}
+	}
+	return count
+}
+
+/**
+ *  Post Handler
+ *  ~~~~~~~~~~~~
+ *  Accepts messages posted as:
+ *
+ *      application/json          - one message
+ *      application/x-ndjson      - messages, one per line
+ *      application/vnd.dim.frame - hybrid frames (or NDJSON lines)
+ *
+ *  responds '202 Accepted' with {"accepted": N, "duplicates": M},
+ *  or '413' when the body exceeds the batch limits
+ */
+type PostHandler struct {
+
+	_sink MessageSink
+	_seen FingerprintSet  // nil for no idempotency check
+	_limits Limits
+
+	_maxBody int64     // total size of one request body
+	_maxMessages int   // messages in one request body
+}
+
+func NewPostHandler(sink MessageSink, seen FingerprintSet) *PostHandler {
+	handler := new(PostHandler)
+	handler.Init(sink, seen)
+	return handler
+}
+
+func (handler *PostHandler) Init(sink MessageSink, seen FingerprintSet) *PostHandler {
+	handler._sink = sink
+	handler._seen = seen
+	handler._limits = DefaultLimits()
+	handler._maxBody = 16 * 1024 * 1024
+	handler._maxMessages = 256
+	return handler
+}
+
+func (handler *PostHandler) SetLimits(limits Limits) {
+	handler._limits = limits
+}
+
+/**
+ *  Caps for one request, all messages are parsed before delivery
+ *
+ * @param maxBody     - total size of the body (0 for no limit)
+ * @param maxMessages - message count (0 for no limit)
+ */
+func (handler *PostHandler) SetBatchLimits(maxBody int64, maxMessages int) {
+	handler._maxBody = maxBody
+	handler._maxMessages = maxMessages
+}
+
+//-------- http.Handler
+
+func (handler *PostHandler) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	if request.Method != http.MethodPost {
+		writer.Header().Set("Allow", http.MethodPost)
+		http.Error(writer, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	mediaType, _, err := mime.ParseMediaType(request.Header.Get("Content-Type"))
+	if err != nil {
+		mediaType = MediaTypeJSON
+	}
+	var body io.Reader = request.Body
+	if handler._maxBody > 0 {
+		// MaxBytesReader also tells the server to close the connection
+		body = &limitedReader{
+			_reader: http.MaxBytesReader(writer, request.Body, handler._maxBody),
+			_remaining: handler._maxBody,
+		}
+	}
+	var messages []ReliableMessage
+	switch mediaType {
+	case MediaTypeJSON:
+		var rMsg ReliableMessage
+		rMsg, err = ParseReliableMessageReader(body, handler._limits)
+		if err == nil && rMsg == nil {
+			err = ErrMessageMalformed
+		}
+		messages = []ReliableMessage{rMsg}
+	case MediaTypeNDJSON, MediaTypeFrame:
+		messages, err = handler.readFrames(body)
+	default:
+		http.Error(writer, "unsupported media type", http.StatusUnsupportedMediaType)
+		return
+	}
+	if err != nil {
+		if err == ErrMessageTooLarge || err == ErrTooManyMessages {
+			http.Error(writer, err.Error(), http.StatusRequestEntityTooLarge)
+		} else {
+			http.Error(writer, err.Error(), http.StatusBadRequest)
+		}
+		return
+	}
+	accepted, duplicates := 0, 0
+	for _, rMsg := range messages {
+		if handler._seen != nil && !handler._seen.Remember(MessageFingerprint(rMsg)) {
+			duplicates++
+			continue
+		}
+		if err = handler._sink.Deliver(rMsg); err != nil {
+			http.Error(writer, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		accepted++
+	}
+	writer.Header().Set("Content-Type", MediaTypeJSON)
+	writer.WriteHeader(http.StatusAccepted)
+	_ = json.NewEncoder(writer).Encode(map[string]int{
+		"accepted": accepted,
+		"duplicates": duplicates,
+	})
+}
+
+func (handler *PostHandler) readFrames(body io.Reader) ([]ReliableMessage, error) {
+	codec := NewFrameCodec(FrameJSON)
+	codec.SetLimits(handler._limits)
+	reader := bufio.NewReader(body)
+	messages := make([]ReliableMessage, 0, 1)
+	for {
+		// skip blank lines between NDJSON records
+		if next, err := reader.Peek(1); err == io.EOF {
+			return messages, nil
+		} else if err != nil {
+			return nil, err
+		} else if next[0] == '\n' || next[0] == '\r' {
+			_, _ = reader.ReadByte()
+			continue
+		}
+		rMsg, err := codec.ReadFrame(reader)
+		if err != nil {
+			return nil, err
+		} else if rMsg == nil {
+			return nil, ErrMessageMalformed
+		} else if handler._maxMessages > 0 && len(messages) >= handler._maxMessages {
+			return nil, ErrTooManyMessages
+		}
+		messages = append(messages, rMsg)
+	}
+}
+
+/**
+ *  Pull Handler
+ *  ~~~~~~~~~~~~
+ *  Streams messages as NDJSON, or hybrid frames when the client
+ *  accepts 'application/vnd.dim.frame'; each message is flushed
+ *  as soon as it's written.
+ */
+type PullHandler struct {
+
+	_source func(request *http.Request) MessageIterator
+	_filter *Filter
+}
+
+func NewPullHandler(source func(request *http.Request) MessageIterator, filter *Filter) *PullHandler {
+	handler := new(PullHandler)
+	handler.Init(source, filter)
+	return handler
+}
+
+func (handler *PullHandler) Init(source func(request *http.Request) MessageIterator, filter *Filter) *PullHandler {
+	handler._source = source
+	handler._filter = filter
+	return handler
+}
+
+//-------- http.Handler
+
+func (handler *PullHandler) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	if request.Method != http.MethodGet {
+		writer.Header().Set("Allow", http.MethodGet)
+		http.Error(writer, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	it := handler._source(request)
+	if it == nil {
+		http.Error(writer, "not found", http.StatusNotFound)
+		return
+	}
+	codec := NewFrameCodec(FrameJSON)
+	if acceptsMediaType(request, MediaTypeFrame) {
+		codec.SetBinarySupported(true)
+		writer.Header().Set("Content-Type", MediaTypeFrame)
+	} else {
+		writer.Header().Set("Content-Type", MediaTypeNDJSON)
+	}
+	flusher, _ := writer.(http.Flusher)
+	for rMsg := it.Next(); rMsg != nil; rMsg = it.Next() {
+		if !handler._filter.Match(rMsg) {
+			continue
+		}
+		if err := codec.WriteFrame(writer, rMsg); err != nil {
+			// connection closed
+			return
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+}
+
+func acceptsMediaType(request *http.Request, mediaType string) bool {
+	for _, accept := range strings.Split(request.Header.Get("Accept"), ",") {
+		if parsed, _, err := mime.ParseMediaType(strings.TrimSpace(accept)); err == nil && parsed == mediaType {
+			return true
+		}
+	}
+	return false
+}
+
+/**
+ *  Build request for posting one message
+ *
+ * @param url    - post handler URL
+ * @param rMsg   - message
+ * @param format - FrameJSON or FrameHybrid, by the server's capability
+ * @return request with Content-Type & Idempotency-Key set
+ */
+func NewPostRequest(url string, rMsg ReliableMessage, format FrameFormat) (*http.Request, error) {
+	body, err := NewFrameCodec(format).Encode(rMsg)
+	if err != nil {
+		return nil, err
+	}
+	request, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	if format == FrameHybrid {
+		request.Header.Set("Content-Type", MediaTypeFrame)
+	} else {
+		request.Header.Set("Content-Type", MediaTypeJSON)
+	}
+	request.Header.Set(HeaderIdempotencyKey, MessageFingerprint(rMsg))
+	return request, nil
+}
@@ -0,0 +1,95 @@
+/* license: https://mit-license.org
+ *
+ *  Dao-Ke-Dao: Universal Message Module
+ *
+ *                                Written in 2022 by Moky <albert.moky@gmail.com>
+ *
+ * ==============================================================================
+ * The MIT License (MIT)
+ *
+ * Copyright (c) 2022 Albert Moky
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ * ==============================================================================
+ */
+package dkd_test
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	. "github.com/dimchat/dkd-go/dkd"
+	. "github.com/dimchat/dkd-go/protocol"
+	. "github.com/dimchat/mkm-go/types"
+)
+
+type countingSink struct {
+	delivered int
+}
+
+func (sink *countingSink) Deliver(_ ReliableMessage) error {
+	sink.delivered++
+	return nil
+}
+
+func postLines(handler http.Handler, lines [][]byte) int {
+	body := bytes.Join(lines, []byte{'\n'})
+	request := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(body))
+	request.Header.Set("Content-Type", MediaTypeNDJSON)
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	return recorder.Code
+}
+
+func TestPostHandlerBatchLimits(t *testing.T) {
+	alice, bob := newPeer("alice@a1"), newPeer("bob@b1")
+	var lines [][]byte
+	for i := 0; i < 3; i++ {
+		env := EnvelopeCreate(alice.ID(), bob.ID(), TimeNow())
+		iMsg := NewInstantMessage(nil, env, textContent("hello"))
+		iMsg.SetDelegate(alice)
+		line, err := CanonicalJSON(iMsg.Encrypt(new(testCrypto).GenerateKey(), nil).Sign().Map())
+		if err != nil {
+			t.Fatal(err)
+		}
+		lines = append(lines, line)
+	}
+	total := int64(len(bytes.Join(lines, []byte{'\n'})))
+
+	sink := new(countingSink)
+	handler := NewPostHandler(sink, nil)
+	handler.SetBatchLimits(total, 3)
+	if code := postLines(handler, lines); code != http.StatusAccepted || sink.delivered != 3 {
+		t.Fatalf("unexpected response: %d, delivered %d", code, sink.delivered)
+	}
+
+	sink.delivered = 0
+	handler.SetBatchLimits(total - 1, 0)
+	if code := postLines(handler, lines); code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("expected 413 for oversized body, got %d", code)
+	}
+	handler.SetBatchLimits(0, 2)
+	if code := postLines(handler, lines); code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("expected 413 for too many messages, got %d", code)
+	}
+	if sink.delivered != 0 {
+		t.Fatalf("rejected batch delivered %d messages", sink.delivered)
+	}
+}
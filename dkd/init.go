@@ -30,7 +30,15 @@
  */
 package dkd
 
-import . "github.com/dimchat/dkd-go/protocol"
+import (
+	"os"
+	. "github.com/dimchat/dkd-go/protocol"
+)
+
+//
+//  Build*Factory() only installs the default factory when there is none,
+//  while Set*Factory() always replaces the current one (last set wins).
+//
 
 func BuildEnvelopeFactory() EnvelopeFactory {
 	factory := EnvelopeGetFactory()
@@ -68,11 +76,33 @@ func BuildReliableMessageFactory() ReliableMessageFactory {
 	return factory
 }
 
+/**
+ *  Register Default Factories
+ *  ~~~~~~~~~~~~~~~~~~~~~~~~~~
+ *  Replace the current factories with the defaults in this package
+ */
+func RegisterDefaults() {
+	EnvelopeSetFactory(new(MessageEnvelopeFactory))
+	InstantMessageSetFactory(new(PlainMessageFactory))
+	SecureMessageSetFactory(new(EncryptedMessageFactory))
+	ReliableMessageSetFactory(new(RelayMessageFactory))
+}
+
 /**
  *  Build Message Factories
  *  ~~~~~~~~~~~~~~~~~~~~~~~
+ *  Set environment variable 'DKD_NO_AUTO_INIT=1' to skip,
+ *  then the defaults will only be installed lazily for the missing ones
+ *  when first used.
  */
 func init() {
+	FactoriesSetLoader(buildFactories)
+	if os.Getenv("DKD_NO_AUTO_INIT") == "" {
+		buildFactories()
+	}
+}
+
+func buildFactories() {
 	BuildEnvelopeFactory()
 	BuildInstantMessageFactory()
 	BuildSecureMessageFactory()
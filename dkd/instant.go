@@ -54,18 +54,24 @@ type PlainMessage struct {
 	BaseMessage
 
 	_content Content
+
+	// moderation verdict of the last encryption
+	_verdict *Verdict
 }
 
 func NewInstantMessage(dict map[string]interface{}, head Envelope, body Content) InstantMessage {
 	if ValueIsNil(dict) {
-		dict = head.Map()
+		// copy the envelope, don't touch its inner map
+		dict = head.CopyMap(false)
 		dict["content"] = body.Map()
 	}
 	msg := new(PlainMessage)
 	if msg.BaseMessage.Init(dict) != nil {
-		msg._env = head
+		// envelope is lazy loaded from the copied map,
+		// so setting its fields changes this message
 		msg._content = body
 	}
+	trackSecrets(msg)
 	return msg
 }
 
@@ -105,6 +111,37 @@ func (msg *PlainMessage) Content() Content {
 	return msg._content
 }
 
+func (msg *PlainMessage) Wipe() {
+	// file/image/audio/video content may carry the key for attachment
+	content := msg.Content()
+	if content != nil {
+		content.Remove("password")
+	}
+}
+
+/**
+ *  Get the moderation verdict of the last encryption,
+ *  when Encrypt() returns nil without panic
+ *
+ * @return nil when not blocked
+ */
+func (msg *PlainMessage) ModerationVerdict() *Verdict {
+	return msg._verdict
+}
+
+func (msg *PlainMessage) hasSecrets() bool {
+	content := msg.Content()
+	return content != nil && content.Get("password") != nil
+}
+
+func (msg *PlainMessage) pack(info map[string]interface{}) SecureMessage {
+	sMsg := SecureMessageParse(info)
+	if sMsg != nil {
+		msg.propagateDelegate(sMsg)
+	}
+	return sMsg
+}
+
 /*
  *  Encrypt the Instant Message to Secure Message
  *
@@ -121,23 +158,79 @@ func (msg *PlainMessage) Content() Content {
 /**
  *  Encrypt message, replace 'content' field with encrypted 'data'
  *
- * @param password - symmetric key
- * @return SecureMessage object
+ * @param password - symmetric key; nil for plaintext message
+ * @return SecureMessage object; nil when blocked by moderation hook
  */
 func (msg *PlainMessage) Encrypt(password SymmetricKey, members []ID) SecureMessage {
 	// 0. check attachment for File/Image/Audio/Video message content
 	//    (do it in 'core' module)
 
-	delegate := msg.Delegate()
+	delegate := msg.RequireDelegate()
 	content := msg.Content()
+	msg._verdict = nil
+	if verdict := ContentModerateVerdict(content, msg.Envelope(), true); verdict != nil && verdict.Decision != ALLOW {
+		// blocked by moderation hook
+		msg._verdict = verdict
+		return nil
+	}
+
+	if password == nil {
+		// plaintext message, only encode 'message.content' to 'message.data'
+		data := delegate.SerializeContent(content, nil, msg)
+		info := msg.CopyMap(false)
+		delete(info, "content")
+		info["data"] = delegate.EncodeData(data, msg)
+		SecureMessageSetPlaintext(info, true)
+		return msg.pack(info)
+	}
+
+	// 0.1. take message key from ratchet session for personal message
+	var ratchet *RatchetHeader
+	sessions := sessionKeys(delegate)
+	if sessions != nil && ValueIsNil(members) && msg.isPersonal() {
+		if key, header := sessions.Advance(msg.Sender(), msg.Receiver()); key != nil {
+			password, ratchet = key, header
+		}
+	}
+	info := msg.CopyMap(false)
+	delete(info, "content")
+	// re-encrypting a decoded plaintext message
+	SecureMessageSetPlaintext(info, false)
+	// the ratchet header is bound to AAD and signature
+	MessageSetRatchetHeader(info, ratchet)
 
 	// 1. encrypt 'message.content' to 'message.data'
 	data := delegate.SerializeContent(content, password, msg)
-	data = delegate.EncryptContent(data, password, msg)
+	padding := PaddingPolicyGet()
+	if padding != nil {
+		data = PadData(data, padding.PaddedSize(len(data)))
+	}
+	aad := 0
+	// personal message with 'receivers' will be trimmed for each receiver,
+	// which changes the receiver bound in AAD, so don't use AAD for it
+	sealer, ok := aadDelegate(delegate)
+	if ok && AADGetVersion() > 0 && EnvelopeGetReceivers(msg.Map()) == nil {
+		aad = AADGetVersion()
+		data = sealer.EncryptContentWithAAD(data, MessageBuildAAD(info, aad), password, msg)
+	} else {
+		data = delegate.EncryptContent(data, password, msg)
+	}
 	base64 := delegate.EncodeData(data, msg)
-	info := msg.CopyMap(false)
-	delete(info, "content")
 	info["data"] = base64
+	SecureMessageSetPadded(info, padding != nil)
+	SecureMessageSetAAD(info, aad)
+	if named, ok := cipherDelegate(delegate); ok {
+		SecureMessageSetCipher(info, named.ContentCipher(password, msg))
+	}
+
+	if ratchet != nil {
+		// message key derived by both sides, no 'key'
+		sMsg := msg.pack(info)
+		if sMsg != nil {
+			sessions.Commit(msg.Sender(), msg.Receiver(), ratchet)
+		}
+		return sMsg
+	}
 
 	// 2. encrypt symmetric key(password) to 'message.key' or 'message.keys'
 	// 2.1. serialize symmetric key
@@ -145,9 +238,19 @@ func (msg *PlainMessage) Encrypt(password SymmetricKey, members []ID) SecureMess
 	if key == nil {
 		// A) broadcast message has no key
 		// B) reused key
-		return SecureMessageParse(info)
+		if digester, ok := keyDigestDelegate(delegate); ok {
+			SecureMessageSetKeyDigest(info, digester.DigestKey(password, msg))
+		}
+		return msg.pack(info)
 	}
 	// 2.2. encrypt symmetric key(s)
+	if ValueIsNil(members) {
+		if receivers := msg.Envelope().Receivers(); len(receivers) > 0 {
+			// personal message with carbon copies,
+			// encrypt key for the receiver and all the others into 'keys'
+			members = append([]ID{msg.Receiver()}, receivers...)
+		}
+	}
 	if ValueIsNil(members) {
 		// personal message
 		key = delegate.EncryptKey(key, msg.Receiver(), msg)
@@ -161,7 +264,7 @@ func (msg *PlainMessage) Encrypt(password SymmetricKey, members []ID) SecureMess
 		// 2.4. insert as 'key'
 		info["key"] = base64
 	} else {
-		// group message
+		// group message, or personal message with carbon copies
 		keys := make(map[string]string, len(members))
 		count := 0
 		for _, member := range members {
@@ -183,5 +286,12 @@ func (msg *PlainMessage) Encrypt(password SymmetricKey, members []ID) SecureMess
 	}
 
 	// 3. pack message
-	return SecureMessageParse(info)
+	return msg.pack(info)
+}
+
+// personal message without carbon copies, not broadcast
+func (msg *PlainMessage) isPersonal() bool {
+	receiver := msg.Receiver()
+	return !receiver.IsGroup() && !receiver.IsBroadcast() &&
+		EnvelopeGetReceivers(msg.Map()) == nil
 }
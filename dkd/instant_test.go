@@ -0,0 +1,150 @@
+/* license: https://mit-license.org
+ *
+ *  Dao-Ke-Dao: Universal Message Module
+ *
+ *                                Written in 2022 by Moky <albert.moky@gmail.com>
+ *
+ * ==============================================================================
+ * The MIT License (MIT)
+ *
+ * Copyright (c) 2022 Albert Moky
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ * ==============================================================================
+ */
+package dkd_test
+
+import (
+	"testing"
+	. "github.com/dimchat/dkd-go/dkd"
+	. "github.com/dimchat/dkd-go/protocol"
+	. "github.com/dimchat/mkm-go/types"
+)
+
+func TestInstantMessageKeepsEnvelopeMap(t *testing.T) {
+	alice, bob := newPeer("alice@a1"), newPeer("bob@b1")
+	env := EnvelopeCreate(alice.ID(), bob.ID(), TimeNow())
+	before := snapshot(env.Map())
+	iMsg := NewInstantMessage(nil, env, textContent("hello"))
+	iMsg.SetDelegate(alice)
+	iMsg.Envelope().SetType(TEXT)
+	if snapshot(env.Map()) != before {
+		t.Fatalf("envelope map changed: %s", snapshot(env.Map()))
+	}
+	// envelope view and message map must agree
+	if iMsg.Get("type") == nil {
+		t.Fatalf("envelope type not set in message: %s", snapshot(iMsg.Map()))
+	}
+}
+
+func TestTransformsDontMutateSource(t *testing.T) {
+	alice, bob := newPeer("alice@a1"), newPeer("bob@b1")
+	env := EnvelopeCreate(alice.ID(), bob.ID(), TimeNow())
+	envBefore := snapshot(env.Map())
+	iMsg := NewInstantMessage(nil, env, textContent("hello"))
+	iMsg.SetDelegate(alice)
+	iBefore := snapshot(iMsg.Map())
+
+	sMsg := iMsg.Encrypt(new(testCrypto).GenerateKey(), nil)
+	if sMsg == nil {
+		t.Fatal("failed to encrypt")
+	}
+	sBefore := snapshot(sMsg.Map())
+	rMsg := sMsg.Sign()
+	rMsg.SetDelegate(bob)
+	rBefore := snapshot(rMsg.Map())
+
+	verified := rMsg.Verify()
+	if verified == nil {
+		t.Fatal("failed to verify")
+	}
+	vBefore := snapshot(verified.Map())
+	verified.SetDelegate(bob)
+	decrypted := verified.Decrypt()
+	if decrypted == nil || decrypted.Content().Get("text") != "hello" {
+		t.Fatal("failed to decrypt")
+	}
+
+	checks := []struct {
+		name string
+		before string
+		dict map[string]interface{}
+	}{
+		{"envelope", envBefore, env.Map()},
+		{"instant", iBefore, iMsg.Map()},
+		{"secure", sBefore, sMsg.Map()},
+		{"reliable", rBefore, rMsg.Map()},
+		{"verified", vBefore, verified.Map()},
+	}
+	for _, check := range checks {
+		if after := snapshot(check.dict); after != check.before {
+			t.Errorf("%s changed:\n%s\n%s", check.name, check.before, after)
+		}
+	}
+}
+
+func TestReconcileGroupKeepsPersonal(t *testing.T) {
+	setup()
+	info := map[string]interface{}{
+		"sender": "alice@a1",
+		"receiver": "owner@o1",
+		"time": 1650000000,
+		"content": map[string]interface{}{"type": 1, "sn": 1, "group": "group@g1", "text": "query"},
+	}
+	iMsg := InstantMessageParse(info)
+	if iMsg.Get("group") != nil || iMsg.Envelope().Group() != nil {
+		t.Fatalf("personal message turned into group message: %s", snapshot(iMsg.Map()))
+	}
+	// group message split for a member, content group wins
+	info["group"] = "group@g2"
+	iMsg = InstantMessageParse(info)
+	if iMsg.Get("group") != "group@g1" {
+		t.Fatalf("group not reconciled: %s", snapshot(iMsg.Map()))
+	}
+}
+
+func TestPlaintextFlagKept(t *testing.T) {
+	alice, bob := newPeer("alice@a1"), newPeer("bob@b1")
+	env := EnvelopeCreate(alice.ID(), bob.ID(), TimeNow())
+	iMsg := NewInstantMessage(nil, env, textContent("hello"))
+	iMsg.SetDelegate(alice)
+	sMsg := iMsg.Encrypt(nil, nil)
+	sMsg.SetDelegate(bob)
+
+	decoded := sMsg.Decrypt()
+	if decoded == nil || !SecureMessageIsPlaintext(decoded.Map()) {
+		t.Fatalf("plaintext flag dropped: %v", decoded)
+	}
+	decoded.SetDelegate(bob)
+	encrypted := decoded.Encrypt(new(testCrypto).GenerateKey(), nil)
+	if encrypted == nil || SecureMessageIsPlaintext(encrypted.Map()) {
+		t.Fatal("plaintext flag kept after encryption")
+	}
+}
+
+func TestContentUUIDOptIn(t *testing.T) {
+	if uuid := textContent("hello").UUID(); uuid != "" {
+		t.Fatalf("unexpected uuid: %s", uuid)
+	}
+	ContentSetAutoUUID(true)
+	defer ContentSetAutoUUID(false)
+	if uuid := textContent("hello").UUID(); len(uuid) != 36 {
+		t.Fatalf("invalid uuid: %s", uuid)
+	}
+}
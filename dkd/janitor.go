@@ -0,0 +1,213 @@
+/* license: https://mit-license.org
+ *
+ *  Dao-Ke-Dao: Universal Message Module
+ *
+ *                                Written in 2022 by Moky <albert.moky@gmail.com>
+ *
+ * ==============================================================================
+ * The MIT License (MIT)
+ *
+ * Copyright (c) 2022 Albert Moky
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ * ==============================================================================
+ */
+package dkd
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+/**
+ *  Sweeper
+ *  ~~~~~~~
+ *  State holder which drops expired entries
+ */
+type Sweeper interface {
+
+	/**
+	 *  Drop expired entries
+	 *
+	 * @param now - current time
+	 * @return count of dropped entries
+	 */
+	Sweep(now time.Time) int
+}
+
+// adapter for Purge methods, e.g.: SweepFunc(cache.Purge)
+type SweepFunc func(now time.Time) int
+
+func (fn SweepFunc) Sweep(now time.Time) int {
+	return fn(now)
+}
+
+// sweeper dropping incomplete key tables not updated within timeout
+func KeyTableSweeper(assembler *KeyTableAssembler, timeout time.Duration) Sweeper {
+	return SweepFunc(func(now time.Time) int {
+		return assembler.Sweep(now.Add(-timeout))
+	})
+}
+
+// sweeper dropping rate limit buckets idle for the duration
+func RateLimiterSweeper(limiter *TokenBucketLimiter, idle time.Duration) Sweeper {
+	return SweepFunc(func(now time.Time) int {
+		return limiter.Sweep(idle)
+	})
+}
+
+/**
+ *  Janitor
+ *  ~~~~~~~
+ *  Sweeps all registered helper caches (message cache, dedup fingerprints,
+ *  key table assembler, rate limiter, station queue, ...) at their own
+ *  intervals, so long-running stations don't leak memory:
+ *
+ *      janitor := NewJanitor()
+ *      janitor.Register("cache", SweepFunc(cache.Purge), time.Minute)
+ *      janitor.Register("keys", KeyTableSweeper(assembler, time.Minute), time.Minute)
+ *      go janitor.Run(time.Second, stop)
+ */
+type Janitor struct {
+	_tasks map[string]*janitorTask
+	_lock sync.Mutex
+}
+
+type janitorTask struct {
+	sweeper Sweeper
+	interval time.Duration
+	next time.Time
+	dropped uint64
+}
+
+func NewJanitor() *Janitor {
+	janitor := new(Janitor)
+	janitor.Init()
+	return janitor
+}
+
+func (janitor *Janitor) Init() *Janitor {
+	janitor._tasks = make(map[string]*janitorTask)
+	return janitor
+}
+
+/**
+ *  Register sweeper, replace the old one with the same name
+ *
+ * @param name     - sweeper name
+ * @param sweeper  - state holder
+ * @param interval - sweep interval
+ */
+func (janitor *Janitor) Register(name string, sweeper Sweeper, interval time.Duration) {
+	janitor._lock.Lock()
+	defer janitor._lock.Unlock()
+	janitor._tasks[name] = &janitorTask{
+		sweeper: sweeper,
+		interval: interval,
+		next: time.Now().Add(interval),
+	}
+}
+
+func (janitor *Janitor) Unregister(name string) {
+	janitor._lock.Lock()
+	defer janitor._lock.Unlock()
+	delete(janitor._tasks, name)
+}
+
+// names of registered sweepers, sorted
+func (janitor *Janitor) Names() []string {
+	janitor._lock.Lock()
+	defer janitor._lock.Unlock()
+	names := make([]string, 0, len(janitor._tasks))
+	for name := range janitor._tasks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+/**
+ *  Run sweepers which are due
+ *
+ * @param now - current time
+ * @return count of dropped entries by each sweeper run
+ */
+func (janitor *Janitor) Tick(now time.Time) map[string]int {
+	return janitor.sweep(now, false)
+}
+
+/**
+ *  Run all sweepers now, regardless of their intervals
+ */
+func (janitor *Janitor) SweepAll(now time.Time) map[string]int {
+	return janitor.sweep(now, true)
+}
+
+func (janitor *Janitor) sweep(now time.Time, all bool) map[string]int {
+	// pick due tasks, sweep without holding the lock
+	janitor._lock.Lock()
+	due := make(map[string]*janitorTask)
+	for name, task := range janitor._tasks {
+		if all || !now.Before(task.next) {
+			task.next = now.Add(task.interval)
+			due[name] = task
+		}
+	}
+	janitor._lock.Unlock()
+	results := make(map[string]int, len(due))
+	for name, task := range due {
+		count := task.sweeper.Sweep(now)
+		results[name] = count
+		janitor._lock.Lock()
+		task.dropped += uint64(count)
+		janitor._lock.Unlock()
+	}
+	return results
+}
+
+// total dropped entries by each sweeper
+func (janitor *Janitor) Stats() map[string]uint64 {
+	janitor._lock.Lock()
+	defer janitor._lock.Unlock()
+	stats := make(map[string]uint64, len(janitor._tasks))
+	for name, task := range janitor._tasks {
+		stats[name] = task.dropped
+	}
+	return stats
+}
+
+/**
+ *  Sweep until stopped
+ *
+ * @param tick - how often to check due sweepers
+ * @param stop - close to stop
+ */
+func (janitor *Janitor) Run(tick time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(tick)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case now := <-ticker.C:
+			janitor.Tick(now)
+		}
+	}
+}
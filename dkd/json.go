@@ -0,0 +1,132 @@
+/* license: https://mit-license.org
+ *
+ *  Dao-Ke-Dao: Universal Message Module
+ *
+ *                                Written in 2022 by Moky <albert.moky@gmail.com>
+ *
+ * ==============================================================================
+ * The MIT License (MIT)
+ *
+ * Copyright (c) 2022 Albert Moky
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ * ==============================================================================
+ */
+package dkd
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+)
+
+/**
+ *  Number Preserving JsON Coder
+ *  ~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+ *  Decodes numbers as json.Number instead of float64, so uint64 'sn' keeps
+ *  precise; the protocol getters handle json.Number natively.
+ *
+ *  Install it for the whole process:
+ *      format.JSONSetCoder(new(dkd.NumberJSONCoder))
+ */
+type NumberJSONCoder struct {}
+
+//-------- IObjectCoder
+
+func (coder *NumberJSONCoder) Encode(object interface{}) string {
+	bytes, err := json.Marshal(object)
+	if err != nil {
+		//panic(err)
+		return ""
+	}
+	return string(bytes)
+}
+
+func (coder *NumberJSONCoder) Decode(str string) interface{} {
+	object, err := JSONDecodeNumbers(str)
+	if err != nil {
+		//panic(err)
+		return nil
+	}
+	return object
+}
+
+var errTrailingData = errors.New("invalid character after top-level value")
+
+// decoder state reused among JSONDecodeNumbers calls
+type numberDecoder struct {
+	reader *strings.Reader
+	decoder *json.Decoder
+}
+
+var decoderPool = sync.Pool{
+	New: func() interface{} {
+		reader := strings.NewReader("")
+		decoder := json.NewDecoder(reader)
+		decoder.UseNumber()
+		return &numberDecoder{reader: reader, decoder: decoder}
+	},
+}
+
+/**
+ *  Decode JsON string with json.Number for numbers,
+ *  the decoders (with their buffers) are pooled
+ *
+ * @param str - JsON string
+ * @return Map/List object
+ */
+func JSONDecodeNumbers(str string) (interface{}, error) {
+	state := decoderPool.Get().(*numberDecoder)
+	state.reader.Reset(str)
+	var object interface{}
+	if err := state.decoder.Decode(&object); err != nil {
+		// the decoder keeps the error, don't reuse it
+		return nil, err
+	}
+	if !state.consumed() {
+		// same as json.Unmarshal, the decoder is not reused
+		return nil, errTrailingData
+	}
+	state.reader.Reset("")
+	decoderPool.Put(state)
+	return object, nil
+}
+
+// only whitespace left in the decoder buffer and the reader,
+// so the next string won't be mixed with this one
+func (state *numberDecoder) consumed() bool {
+	return onlySpaces(state.decoder.Buffered()) && onlySpaces(state.reader)
+}
+
+func onlySpaces(reader io.Reader) bool {
+	var buffer [64]byte
+	for {
+		n, err := reader.Read(buffer[:])
+		for _, c := range buffer[:n] {
+			if c != ' ' && c != '\t' && c != '\n' && c != '\r' {
+				return false
+			}
+		}
+		if err != nil {
+			return true
+		}
+	}
+}
@@ -0,0 +1,78 @@
+/* license: https://mit-license.org
+ *
+ *  Dao-Ke-Dao: Universal Message Module
+ *
+ *                                Written in 2022 by Moky <albert.moky@gmail.com>
+ *
+ * ==============================================================================
+ * The MIT License (MIT)
+ *
+ * Copyright (c) 2022 Albert Moky
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ * ==============================================================================
+ */
+package dkd_test
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	. "github.com/dimchat/dkd-go/dkd"
+)
+
+func TestJSONDecodeNumbersReuse(t *testing.T) {
+	inputs := []string{
+		`{"sn": 18446744073709551615}  `,
+		`{"broken": `,
+		`[1, 2] garbage`,
+		`{"a":1} garbage`,
+		`{"sn": 1}`,
+		`42`,
+		`{"sn": 2}`,
+	}
+	for i := 0; i < 3; i++ {
+		for _, str := range inputs {
+			var expected interface{}
+			decoder := json.NewDecoder(strings.NewReader(str))
+			decoder.UseNumber()
+			expectedErr := decoder.Decode(&expected)
+			if expectedErr == nil && json.Unmarshal([]byte(str), new(interface{})) != nil {
+				// trailing data
+				expected, expectedErr = nil, errors.New("trailing data")
+			}
+			object, err := JSONDecodeNumbers(str)
+			if (err == nil) != (expectedErr == nil) || fmt.Sprint(object) != fmt.Sprint(expected) {
+				t.Fatalf("decode %q: got %v (%v), expected %v (%v)", str, object, err, expected, expectedErr)
+			}
+		}
+	}
+}
+
+func BenchmarkJSONDecodeNumbers(b *testing.B) {
+	str := `{"sender":"alice@a1","receiver":"bob@b1","time":1650000000,"data":"AAAA","signature":"AAAA"}`
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := JSONDecodeNumbers(str); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,228 @@
+/* license: https://mit-license.org
+ *
+ *  Dao-Ke-Dao: Universal Message Module
+ *
+ *                                Written in 2022 by Moky <albert.moky@gmail.com>
+ *
+ * ==============================================================================
+ * The MIT License (MIT)
+ *
+ * Copyright (c) 2022 Albert Moky
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ * ==============================================================================
+ */
+package dkd
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"sort"
+	"sync"
+	"time"
+	. "github.com/dimchat/dkd-go/protocol"
+	. "github.com/dimchat/mkm-go/digest"
+	. "github.com/dimchat/mkm-go/types"
+)
+
+/**
+ *  Key Table Chunks
+ *  ~~~~~~~~~~~~~~~~
+ *  For huge groups, the 'keys' table of a reliable message can be split
+ *  into chunks, the head chunk is the original message with partial keys,
+ *  the others only carry the envelope and the rest keys:
+ *
+ *  data format: {
+ *      sender     : "moki@xxx",
+ *      receiver   : "group@yyy",
+ *      time       : 123,
+ *      keys       : {...},      // partial table
+ *      keys_chunk : {
+ *          digest : "...",      // hex(sha256(data))
+ *          index  : 1,
+ *          count  : 3
+ *      }
+ *  }
+ *
+ *  The signature only covers 'data', so the keys can be merged back
+ *  by the receiving station before splitting the group message.
+ */
+func SplitKeyTable(rMsg ReliableMessage, chunkSize int) []map[string]interface{} {
+	keys := rMsg.EncryptedKeys()
+	if chunkSize < 1 || len(keys) <= chunkSize {
+		return []map[string]interface{}{rMsg.CopyMap(false)}
+	}
+	members := make([]string, 0, len(keys))
+	for member := range keys {
+		members = append(members, member)
+	}
+	sort.Strings(members)
+	count := (len(members) + chunkSize - 1) / chunkSize
+	data, _ := rMsg.Get("data").(string)
+	digest := hex.EncodeToString(SHA256([]byte(data)))
+	chunks := make([]map[string]interface{}, count)
+	for index := 0; index < count; index++ {
+		var info map[string]interface{}
+		if index == 0 {
+			info = rMsg.CopyMap(false)
+		} else {
+			info = make(map[string]interface{})
+			for _, name := range []string{"sender", "receiver", "time", "group", "type"} {
+				if value := rMsg.Get(name); value != nil {
+					info[name] = value
+				}
+			}
+		}
+		end := (index + 1) * chunkSize
+		if end > len(members) {
+			end = len(members)
+		}
+		partial := make(map[string]interface{}, end - index * chunkSize)
+		for _, member := range members[index * chunkSize : end] {
+			partial[member] = keys[member]
+		}
+		info["keys"] = partial
+		info["keys_chunk"] = map[string]interface{}{
+			"digest": digest,
+			"index":  index,
+			"count":  count,
+		}
+		chunks[index] = info
+	}
+	return chunks
+}
+
+/**
+ *  Key Table Assembler
+ *  ~~~~~~~~~~~~~~~~~~~
+ *  Collects key table chunks and rebuilds the complete message
+ */
+type KeyTableAssembler struct {
+
+	_pending map[string]*pendingTable
+	_lock sync.Mutex
+}
+
+type pendingTable struct {
+	head   map[string]interface{}
+	keys   map[string]interface{}
+	seen   map[int]bool
+	count  int
+	update time.Time
+}
+
+func NewKeyTableAssembler() *KeyTableAssembler {
+	assembler := new(KeyTableAssembler)
+	assembler.Init()
+	return assembler
+}
+
+func (assembler *KeyTableAssembler) Init() *KeyTableAssembler {
+	assembler._pending = make(map[string]*pendingTable)
+	return assembler
+}
+
+/**
+ *  Add a received message/chunk
+ *
+ * @param info - message info
+ * @return complete message; nil when chunks not all arrived
+ */
+func (assembler *KeyTableAssembler) Add(info map[string]interface{}) ReliableMessage {
+	chunk, ok := info["keys_chunk"].(map[string]interface{})
+	if !ok {
+		// not chunked
+		return ReliableMessageParse(info)
+	}
+	digest, _ := chunk["digest"].(string)
+	index := toInt(chunk["index"])
+	count := toInt(chunk["count"])
+	sender, _ := info["sender"].(string)
+	if digest == "" || count < 1 || index < 0 || index >= count {
+		return nil
+	}
+	key := sender + "|" + digest
+
+	assembler._lock.Lock()
+	defer assembler._lock.Unlock()
+	table := assembler._pending[key]
+	if table == nil {
+		table = &pendingTable{
+			keys:  make(map[string]interface{}),
+			seen:  make(map[int]bool),
+			count: count,
+		}
+		assembler._pending[key] = table
+	}
+	table.update = time.Now()
+	if table.seen[index] {
+		return nil
+	}
+	table.seen[index] = true
+	if partial, ok := info["keys"].(map[string]interface{}); ok {
+		for member, base64 := range partial {
+			table.keys[member] = base64
+		}
+	}
+	if index == 0 {
+		table.head = info
+	}
+	if len(table.seen) < table.count {
+		return nil
+	}
+	// all chunks arrived
+	delete(assembler._pending, key)
+	head := CopyMap(table.head)
+	delete(head, "keys_chunk")
+	head["keys"] = table.keys
+	return ReliableMessageParse(head)
+}
+
+/**
+ *  Drop incomplete tables not updated since the expiry time
+ *
+ * @param expires - expiry time
+ * @return count of dropped tables
+ */
+func (assembler *KeyTableAssembler) Sweep(expires time.Time) int {
+	assembler._lock.Lock()
+	defer assembler._lock.Unlock()
+	count := 0
+	for key, table := range assembler._pending {
+		if table.update.Before(expires) {
+			delete(assembler._pending, key)
+			count++
+		}
+	}
+	return count
+}
+
+func toInt(value interface{}) int {
+	switch v := value.(type) {
+	case float64:
+		return int(v)
+	case int:
+		return v
+	case json.Number:
+		if number, err := v.Int64(); err == nil {
+			return int(number)
+		}
+	}
+	return -1
+}
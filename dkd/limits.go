@@ -0,0 +1,240 @@
+/* license: https://mit-license.org
+ *
+ *  Dao-Ke-Dao: Universal Message Module
+ *
+ *                                Written in 2022 by Moky <albert.moky@gmail.com>
+ *
+ * ==============================================================================
+ * The MIT License (MIT)
+ *
+ * Copyright (c) 2022 Albert Moky
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ * ==============================================================================
+ */
+package dkd
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	. "github.com/dimchat/dkd-go/protocol"
+)
+
+var (
+	ErrMessageTooLarge  = errors.New("message too large")
+	ErrNestingTooDeep   = errors.New("message nesting too deep")
+	ErrStringTooLong    = errors.New("message string too long")
+	ErrTooManyKeys      = errors.New("too many keys in message")
+	ErrMessageMalformed = errors.New("malformed message")
+)
+
+/**
+ *  Parsing Limits
+ *  ~~~~~~~~~~~~~~
+ *  Guards for decoding messages from untrusted peers,
+ *  zero means no limit
+ */
+type Limits struct {
+	MaxSize   int64  // bytes of the whole message
+	MaxDepth  int    // nesting depth of objects/arrays
+	MaxString int    // length of any string (keys & values)
+	MaxKeys   int    // cardinality of the 'keys' map (group message)
+}
+
+func DefaultLimits() Limits {
+	return Limits{
+		MaxSize:   1024 * 1024,
+		MaxDepth:  16,
+		MaxString: 512 * 1024,
+		MaxKeys:   1024,
+	}
+}
+
+/**
+ *  Parse one reliable message from the reader with limits,
+ *  the message is decoded token by token, so it fails as soon as
+ *  any limit is exceeded, without buffering the whole input
+ *
+ * @param reader - input stream holding one message
+ * @param limits - parsing limits
+ * @return ReliableMessage, or error
+ */
+func ParseReliableMessageReader(reader io.Reader, limits Limits) (ReliableMessage, error) {
+	info, err := newLimitedParser(reader, limits).root()
+	if err != nil {
+		return nil, err
+	}
+	rMsg := ReliableMessageParse(info)
+	if rMsg == nil {
+		return nil, ErrMessageMalformed
+	}
+	return rMsg, nil
+}
+
+type limitedReader struct {
+	_reader io.Reader
+	_remaining int64
+}
+
+func (lr *limitedReader) Read(p []byte) (int, error) {
+	if lr._remaining <= 0 {
+		// exactly at the limit is fine if the stream ends here
+		var probe [1]byte
+		if n, err := lr._reader.Read(probe[:]); n == 0 && err == io.EOF {
+			return 0, io.EOF
+		}
+		return 0, ErrMessageTooLarge
+	}
+	if int64(len(p)) > lr._remaining {
+		p = p[:lr._remaining]
+	}
+	n, err := lr._reader.Read(p)
+	lr._remaining -= int64(n)
+	return n, err
+}
+
+type limitedParser struct {
+	_decoder *json.Decoder
+	_limits Limits
+}
+
+func newLimitedParser(reader io.Reader, limits Limits) *limitedParser {
+	if limits.MaxSize > 0 {
+		reader = &limitedReader{_reader: reader, _remaining: limits.MaxSize}
+	}
+	return &limitedParser{_decoder: json.NewDecoder(reader), _limits: limits}
+}
+
+// decode one JsON object within the limits
+func (parser *limitedParser) root() (map[string]interface{}, error) {
+	token, err := parser._decoder.Token()
+	if err != nil {
+		return nil, err
+	}
+	if token != json.Delim('{') {
+		return nil, ErrMessageMalformed
+	}
+	return parser.object(1, "")
+}
+
+// nothing but spaces after the root object
+func (parser *limitedParser) finished() bool {
+	_, err := parser._decoder.Token()
+	return err == io.EOF
+}
+
+func (parser *limitedParser) value(depth int) (interface{}, error) {
+	token, err := parser._decoder.Token()
+	if err != nil {
+		return nil, err
+	}
+	switch value := token.(type) {
+	case json.Delim:
+		if value == '{' {
+			return parser.object(depth + 1, "")
+		} else if value == '[' {
+			return parser.array(depth + 1)
+		}
+		return nil, ErrMessageMalformed
+	case string:
+		if err = parser.checkString(value); err != nil {
+			return nil, err
+		}
+	}
+	return token, nil
+}
+
+// the opening '{' was consumed
+func (parser *limitedParser) object(depth int, name string) (map[string]interface{}, error) {
+	if parser._limits.MaxDepth > 0 && depth > parser._limits.MaxDepth {
+		return nil, ErrNestingTooDeep
+	}
+	info := make(map[string]interface{})
+	for parser._decoder.More() {
+		token, err := parser._decoder.Token()
+		if err != nil {
+			return nil, err
+		}
+		key, ok := token.(string)
+		if !ok {
+			return nil, ErrMessageMalformed
+		}
+		if err = parser.checkString(key); err != nil {
+			return nil, err
+		}
+		if name == "keys" && parser._limits.MaxKeys > 0 && len(info) >= parser._limits.MaxKeys {
+			return nil, ErrTooManyKeys
+		}
+		var value interface{}
+		if depth == 1 && key == "keys" {
+			// check cardinality of 'keys' while decoding
+			value, err = parser.keys(depth)
+		} else {
+			value, err = parser.value(depth)
+		}
+		if err != nil {
+			return nil, err
+		}
+		info[key] = value
+	}
+	// consume the closing '}'
+	if _, err := parser._decoder.Token(); err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
+func (parser *limitedParser) keys(depth int) (interface{}, error) {
+	token, err := parser._decoder.Token()
+	if err != nil {
+		return nil, err
+	}
+	if token != json.Delim('{') {
+		return nil, ErrMessageMalformed
+	}
+	return parser.object(depth + 1, "keys")
+}
+
+// the opening '[' was consumed
+func (parser *limitedParser) array(depth int) ([]interface{}, error) {
+	if parser._limits.MaxDepth > 0 && depth > parser._limits.MaxDepth {
+		return nil, ErrNestingTooDeep
+	}
+	array := make([]interface{}, 0)
+	for parser._decoder.More() {
+		value, err := parser.value(depth)
+		if err != nil {
+			return nil, err
+		}
+		array = append(array, value)
+	}
+	// consume the closing ']'
+	if _, err := parser._decoder.Token(); err != nil {
+		return nil, err
+	}
+	return array, nil
+}
+
+func (parser *limitedParser) checkString(text string) error {
+	if parser._limits.MaxString > 0 && len(text) > parser._limits.MaxString {
+		return ErrStringTooLong
+	}
+	return nil
+}
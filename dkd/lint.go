@@ -0,0 +1,196 @@
+/* license: https://mit-license.org
+ *
+ *  Dao-Ke-Dao: Universal Message Module
+ *
+ *                                Written in 2022 by Moky <albert.moky@gmail.com>
+ *
+ * ==============================================================================
+ * The MIT License (MIT)
+ *
+ * Copyright (c) 2022 Albert Moky
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ * ==============================================================================
+ */
+package dkd
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+	. "github.com/dimchat/dkd-go/protocol"
+	. "github.com/dimchat/mkm-go/protocol"
+)
+
+type Severity uint8
+
+const (
+	LintInfo    Severity = 0  // harmless, e.g.: unknown field
+	LintWarning Severity = 1  // works now, but should be fixed
+	LintError   Severity = 2  // message will be rejected or mishandled
+)
+
+func (severity Severity) String() string {
+	switch severity {
+	case LintInfo:
+		return "info"
+	case LintWarning:
+		return "warning"
+	case LintError:
+		return "error"
+	}
+	return fmt.Sprintf("Severity(%d)", severity)
+}
+
+/**
+ *  Lint Finding
+ *  ~~~~~~~~~~~~
+ */
+type Finding struct {
+	Severity Severity
+	Field    string  // e.g.: "time", "content.thumbnail"
+	Message  string
+}
+
+func (finding Finding) String() string {
+	return fmt.Sprintf("%s: %s: %s", finding.Severity, finding.Field, finding.Message)
+}
+
+// max length of 'content.thumbnail' (base64) before warning
+var lintThumbnailSize = 8 * 1024
+
+func LintSetThumbnailSize(size int) {
+	lintThumbnailSize = size
+}
+
+// fields known by this package and the core layer
+var lintKnownFields = map[string]bool{
+	// envelope
+	"sender": true, "receiver": true, "time": true, "type": true, "group": true,
+	"receivers": true, "carbon": true, "send_after": true, "no_ack": true,
+	// instant message
+	"content": true,
+	// secure message
+	"data": true, "key": true, "keys": true, "keys_chunk": true, "key_digest": true,
+	"plaintext": true, "padded": true, "ratchet": true, "chain_idx": true, "cipher": true, "aad": true,
+	// reliable message
+	"signature": true, "meta": true, "visa": true, "preview": true,
+	// for station
+	"traces": true,
+}
+
+// deprecated fields with hints
+var lintDeprecatedFields = map[string]string{
+	"profile": "use 'visa' instead",
+}
+
+/**
+ *  Register extra fields, so Lint won't report them as unknown
+ */
+func LintAllowField(name string) {
+	lintKnownFields[name] = true
+}
+
+/**
+ *  Check message for non-fatal issues
+ *
+ * @param msg - instant/secure/reliable message info
+ * @return findings, empty for a clean message
+ */
+func Lint(msg map[string]interface{}) []Finding {
+	findings := make([]Finding, 0)
+	report := func(severity Severity, field string, format string, args ...interface{}) {
+		findings = append(findings, Finding{severity, field, fmt.Sprintf(format, args...)})
+	}
+	// envelope
+	for _, field := range []string{"sender", "receiver"} {
+		if msg[field] == nil {
+			report(LintError, field, "missing")
+		} else if IDParse(msg[field]) == nil {
+			report(LintError, field, "invalid ID: %v", msg[field])
+		}
+	}
+	lintTime(msg["time"], "time", report)
+	// body
+	content, hasContent := msg["content"].(map[string]interface{})
+	_, hasData := msg["data"].(string)
+	if hasContent && hasData {
+		report(LintError, "data", "both 'content' and 'data' exist")
+	} else if !hasContent && !hasData {
+		report(LintError, "content", "neither 'content' nor 'data' exists")
+	}
+	if hasContent {
+		lintContent(content, report)
+	}
+	if signature, ok := msg["signature"]; ok {
+		if !hasData {
+			report(LintError, "signature", "signed message without 'data'")
+		} else if !ReliableMessagePlausibleSignature(msg) {
+			report(LintWarning, "signature", "implausible signature: %.16v...", signature)
+		}
+	}
+	// fields
+	for field := range msg {
+		if hint, ok := lintDeprecatedFields[field]; ok {
+			report(LintWarning, field, "deprecated, %s", hint)
+		} else if !lintKnownFields[field] && ReliableMessageGetAttachment(msg, field) == nil {
+			report(LintInfo, field, "unknown field")
+		}
+	}
+	return findings
+}
+
+func lintContent(content map[string]interface{}, report func(Severity, string, string, ...interface{})) {
+	if content["type"] == nil {
+		report(LintError, "content.type", "missing")
+	}
+	switch sn := content["sn"].(type) {
+	case nil:
+		report(LintError, "content.sn", "missing")
+	case string:
+		report(LintWarning, "content.sn", "serial number as string: %q", sn)
+	}
+	if content["time"] != nil {
+		lintTime(content["time"], "content.time", report)
+	}
+	if thumbnail, ok := content["thumbnail"].(string); ok && len(thumbnail) > lintThumbnailSize {
+		report(LintWarning, "content.thumbnail", "oversize thumbnail: %d > %d bytes", len(thumbnail), lintThumbnailSize)
+	}
+}
+
+func lintTime(value interface{}, field string, report func(Severity, string, string, ...interface{})) {
+	timestamp, ok := value.(float64)
+	if number, isNumber := value.(json.Number); isNumber {
+		var err error
+		timestamp, err = number.Float64()
+		ok = err == nil
+	}
+	if value == nil {
+		report(LintWarning, field, "missing")
+		return
+	} else if !ok {
+		report(LintError, field, "not a number: %v", value)
+		return
+	}
+	if timestamp > 1e11 {
+		report(LintWarning, field, "time in milliseconds: %v", value)
+	} else if timestamp > float64(time.Now().Add(24 * time.Hour).Unix()) {
+		report(LintWarning, field, "time in the future: %v", value)
+	}
+}
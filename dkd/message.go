@@ -92,9 +92,32 @@ func (msg *BaseMessage) Init(dict map[string]interface{}) Message {
 //-------- IMessage
 
 func (msg *BaseMessage) Delegate() MessageDelegate {
+	if msg._delegate == nil {
+		return MessageGetDefaultDelegate()
+	}
 	return msg._delegate
 }
 
+/**
+ *  Pass the delegate to the message transformed from this one
+ */
+func (msg *BaseMessage) propagateDelegate(other Message) {
+	if msg._delegate != nil {
+		other.SetDelegate(msg._delegate)
+	}
+}
+
+/**
+ *  Get delegate for transforming, panic with ErrDelegateNotSet if not found
+ */
+func (msg *BaseMessage) RequireDelegate() MessageDelegate {
+	delegate := msg.Delegate()
+	if delegate == nil {
+		panic(ErrDelegateNotSet)
+	}
+	return delegate
+}
+
 func (msg *BaseMessage) SetDelegate(delegate MessageDelegate) {
 	msg._delegate = delegate
 }
@@ -0,0 +1,141 @@
+/* license: https://mit-license.org
+ *
+ *  Dao-Ke-Dao: Universal Message Module
+ *
+ *                                Written in 2022 by Moky <albert.moky@gmail.com>
+ *
+ * ==============================================================================
+ * The MIT License (MIT)
+ *
+ * Copyright (c) 2022 Albert Moky
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ * ==============================================================================
+ */
+package dkd
+
+import (
+	"sync"
+	. "github.com/dimchat/dkd-go/protocol"
+)
+
+/**
+ *  Media Hasher
+ *  ~~~~~~~~~~~~
+ *  Computes hashes of the media attached in content (exact or perceptual),
+ *  file data is loaded by the application (e.g. from 'URL' or 'data').
+ */
+type MediaHasher interface {
+
+	// hash algorithm, e.g.: "sha256", "pdq"
+	Algorithm() string
+
+	// return hex hashes of all media in the content, nil for no media
+	HashMedia(content Content) []string
+}
+
+/**
+ *  Hash Denylist
+ *  ~~~~~~~~~~~~~
+ *  Lookup hashes from operator provided lists
+ */
+type Denylist interface {
+
+	/**
+	 *  Check hash
+	 *
+	 * @param algorithm - hash algorithm
+	 * @param hash      - hex hash
+	 * @return nil when not listed
+	 */
+	Lookup(algorithm string, hash string) *Verdict
+}
+
+/**
+ *  Hash List Moderator
+ *  ~~~~~~~~~~~~~~~~~~~
+ *  Moderation hook which hashes media with all hashers and checks them
+ *  against the denylist, the first matched verdict wins.
+ */
+type HashListModerator struct {
+	_denylist Denylist
+	_hashers []MediaHasher
+
+	// callback for matched verdicts (audit log for the operator)
+	_report func(verdict *Verdict, env Envelope, outgoing bool)
+
+	_lock sync.Mutex
+}
+
+func NewHashListModerator(denylist Denylist, hashers ...MediaHasher) *HashListModerator {
+	moderator := new(HashListModerator)
+	moderator.Init(denylist, hashers...)
+	return moderator
+}
+
+func (moderator *HashListModerator) Init(denylist Denylist, hashers ...MediaHasher) *HashListModerator {
+	moderator._denylist = denylist
+	moderator._hashers = hashers
+	moderator._report = nil
+	return moderator
+}
+
+func (moderator *HashListModerator) AddHasher(hasher MediaHasher) {
+	moderator._lock.Lock()
+	defer moderator._lock.Unlock()
+	moderator._hashers = append(moderator._hashers, hasher)
+}
+
+func (moderator *HashListModerator) SetReporter(report func(verdict *Verdict, env Envelope, outgoing bool)) {
+	moderator._lock.Lock()
+	defer moderator._lock.Unlock()
+	moderator._report = report
+}
+
+//-------- IModerationHook
+
+func (moderator *HashListModerator) Moderate(content Content, env Envelope, outgoing bool) *Verdict {
+	moderator._lock.Lock()
+	hashers := moderator._hashers
+	report := moderator._report
+	moderator._lock.Unlock()
+	for _, hasher := range hashers {
+		algorithm := hasher.Algorithm()
+		for _, hash := range hasher.HashMedia(content) {
+			verdict := moderator._denylist.Lookup(algorithm, hash)
+			if verdict == nil {
+				continue
+			}
+			// the denylist may share its verdicts, don't touch them
+			copied := *verdict
+			verdict = &copied
+			if verdict.Algorithm == "" {
+				verdict.Algorithm = algorithm
+			}
+			if verdict.Hash == "" {
+				verdict.Hash = hash
+			}
+			if report != nil {
+				report(verdict, env, outgoing)
+			}
+			return verdict
+		}
+	}
+	return nil
+}
@@ -0,0 +1,171 @@
+/* license: https://mit-license.org
+ *
+ *  Dao-Ke-Dao: Universal Message Module
+ *
+ *                                Written in 2022 by Moky <albert.moky@gmail.com>
+ *
+ * ==============================================================================
+ * The MIT License (MIT)
+ *
+ * Copyright (c) 2022 Albert Moky
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ * ==============================================================================
+ */
+package dkd
+
+import (
+	"net/url"
+	"strconv"
+	"strings"
+	. "github.com/dimchat/dkd-go/protocol"
+	. "github.com/dimchat/mkm-go/protocol"
+)
+
+const (
+	TopicUser      = "user"
+	TopicGroup     = "group"
+	TopicBroadcast = "broadcast"
+)
+
+/**
+ *  Topic Info
+ *  ~~~~~~~~~~
+ *  Fields encoded in MQTT topic:
+ *
+ *      {prefix}/user/{receiver}/{type}
+ *      {prefix}/group/{group}/{type}
+ *      {prefix}/broadcast/{receiver}/{type}
+ *
+ *  type is the decimal content type (0 when not exposed in envelope);
+ *  MQTT special chars ('/', '+', '#') in ID are percent-encoded.
+ */
+type TopicInfo struct {
+	Kind         string
+	Conversation ID
+	Type         ContentType
+}
+
+/**
+ *  Topic Mapper
+ *  ~~~~~~~~~~~~
+ *  Maps reliable messages to MQTT topics & payloads, so devices can
+ *  exchange messages over existing brokers:
+ *
+ *      device subscribes "{prefix}/user/{me}/#" and "{prefix}/group/{group}/#";
+ *      station publishes each message to Topic(rMsg).
+ */
+type TopicMapper struct {
+
+	_prefix string
+	_codec *FrameCodec
+}
+
+func NewTopicMapper(prefix string, format FrameFormat) *TopicMapper {
+	mapper := new(TopicMapper)
+	mapper.Init(prefix, format)
+	return mapper
+}
+
+func (mapper *TopicMapper) Init(prefix string, format FrameFormat) *TopicMapper {
+	mapper._prefix = strings.TrimSuffix(prefix, "/")
+	mapper._codec = NewFrameCodec(format)
+	return mapper
+}
+
+/**
+ *  Get topic for publishing the message
+ *
+ *  Split group messages go to the member's topic, as the receiver
+ *  has been changed to the member.
+ */
+func (mapper *TopicMapper) Topic(rMsg ReliableMessage) string {
+	receiver := rMsg.Receiver()
+	kind := TopicUser
+	if receiver.IsBroadcast() {
+		kind = TopicBroadcast
+	} else if receiver.IsGroup() {
+		kind = TopicGroup
+	}
+	return mapper.topic(kind, receiver, rMsg.Type())
+}
+
+func (mapper *TopicMapper) topic(kind string, conversation ID, msgType ContentType) string {
+	return mapper._prefix + "/" + kind + "/" + escapeTopicLevel(conversation.String()) +
+		"/" + strconv.Itoa(int(msgType))
+}
+
+/**
+ *  Get topic filter for subscribing all messages to the user
+ */
+func (mapper *TopicMapper) UserFilter(user ID) string {
+	return mapper._prefix + "/" + TopicUser + "/" + escapeTopicLevel(user.String()) + "/#"
+}
+
+/**
+ *  Get topic filter for subscribing all messages in the group
+ */
+func (mapper *TopicMapper) GroupFilter(group ID) string {
+	return mapper._prefix + "/" + TopicGroup + "/" + escapeTopicLevel(group.String()) + "/#"
+}
+
+/**
+ *  Parse topic built by this mapper
+ *
+ * @return nil when prefix not match or topic malformed
+ */
+func (mapper *TopicMapper) ParseTopic(topic string) *TopicInfo {
+	if !strings.HasPrefix(topic, mapper._prefix + "/") {
+		return nil
+	}
+	levels := strings.Split(topic[len(mapper._prefix) + 1:], "/")
+	if len(levels) != 3 {
+		return nil
+	}
+	switch levels[0] {
+	case TopicUser, TopicGroup, TopicBroadcast:
+	default:
+		return nil
+	}
+	text, err := url.PathUnescape(levels[1])
+	if err != nil {
+		return nil
+	}
+	conversation := IDParse(text)
+	msgType, err := strconv.ParseUint(levels[2], 10, 8)
+	if conversation == nil || err != nil {
+		return nil
+	}
+	return &TopicInfo{Kind: levels[0], Conversation: conversation, Type: ContentType(msgType)}
+}
+
+func (mapper *TopicMapper) EncodePayload(rMsg ReliableMessage) ([]byte, error) {
+	return mapper._codec.Encode(rMsg)
+}
+
+// accepts both JsON & hybrid frames
+func (mapper *TopicMapper) DecodePayload(payload []byte) (ReliableMessage, error) {
+	return mapper._codec.Decode(payload)
+}
+
+var topicEscaper = strings.NewReplacer("%", "%25", "/", "%2F", "+", "%2B", "#", "%23")
+
+func escapeTopicLevel(text string) string {
+	return topicEscaper.Replace(text)
+}
@@ -0,0 +1,199 @@
+/* license: https://mit-license.org
+ *
+ *  Dao-Ke-Dao: Universal Message Module
+ *
+ *                                Written in 2022 by Moky <albert.moky@gmail.com>
+ *
+ * ==============================================================================
+ * The MIT License (MIT)
+ *
+ * Copyright (c) 2022 Albert Moky
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ * ==============================================================================
+ */
+package pipeline
+
+import (
+	"sync"
+	"sync/atomic"
+	. "github.com/dimchat/dkd-go/dkd"
+	. "github.com/dimchat/dkd-go/protocol"
+)
+
+/**
+ *  Stage Metrics
+ *  ~~~~~~~~~~~~~
+ */
+type Metrics struct {
+	Processed uint64  // messages passed this stage
+	Failed    uint64  // messages failed in this stage
+	Pending   int     // messages waiting in queue
+}
+
+/**
+ *  Verify-then-Decrypt Pipeline
+ *  ~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+ *  Signature verification and key decryption dominate the CPU on relays,
+ *  so they run in two separated pools with their own concurrency limits:
+ *
+ *      SubmitReliable -> [verify pool] -> [decrypt pool] -> delegate
+ *
+ *  (the Go runtime schedules goroutines over all cores, there is no
+ *   per-stage CPU affinity; limit GOMAXPROCS to reserve cores if needed)
+ */
+type Pipeline struct {
+
+	// stats, keep 64-bit fields first for atomic alignment
+	_verified uint64
+	_verifyFailed uint64
+	_decrypted uint64
+	_decryptFailed uint64
+
+	_delegate ProcessorDelegate
+
+	_verifiers int
+	_decrypters int
+
+	_verifyQueue chan ReliableMessage
+	_decryptQueue chan *verifiedMessage
+
+	_verifyGroup sync.WaitGroup
+	_decryptGroup sync.WaitGroup
+	_stopped bool
+
+	_lock sync.RWMutex
+}
+
+type verifiedMessage struct {
+	sMsg SecureMessage
+	rMsg ReliableMessage
+}
+
+func NewPipeline(delegate ProcessorDelegate, verifiers int, decrypters int, queueSize int) *Pipeline {
+	pipe := new(Pipeline)
+	pipe.Init(delegate, verifiers, decrypters, queueSize)
+	return pipe
+}
+
+func (pipe *Pipeline) Init(delegate ProcessorDelegate, verifiers int, decrypters int, queueSize int) *Pipeline {
+	if verifiers < 1 {
+		verifiers = 1
+	}
+	if decrypters < 1 {
+		decrypters = 1
+	}
+	pipe._delegate = delegate
+	pipe._verifiers = verifiers
+	pipe._decrypters = decrypters
+	pipe._verifyQueue = make(chan ReliableMessage, queueSize)
+	pipe._decryptQueue = make(chan *verifiedMessage, queueSize)
+	return pipe
+}
+
+func (pipe *Pipeline) Start() {
+	for i := 0; i < pipe._verifiers; i++ {
+		pipe._verifyGroup.Add(1)
+		go pipe.verify()
+	}
+	for i := 0; i < pipe._decrypters; i++ {
+		pipe._decryptGroup.Add(1)
+		go pipe.decrypt()
+	}
+}
+
+/**
+ *  Stop accepting messages, and wait for both stages to drain
+ */
+func (pipe *Pipeline) Stop() {
+	// wait for the blocked submitters
+	pipe._lock.Lock()
+	stopped := pipe._stopped
+	pipe._stopped = true
+	pipe._lock.Unlock()
+	if !stopped {
+		close(pipe._verifyQueue)
+		pipe._verifyGroup.Wait()
+		close(pipe._decryptQueue)
+	}
+	pipe._verifyGroup.Wait()
+	pipe._decryptGroup.Wait()
+}
+
+/**
+ *  Submit message, block when the verify queue is full
+ *
+ * @param rMsg - received message
+ * @return false when stopped
+ */
+func (pipe *Pipeline) SubmitReliable(rMsg ReliableMessage) bool {
+	pipe._lock.RLock()
+	defer pipe._lock.RUnlock()
+	if pipe._stopped {
+		return false
+	}
+	pipe._verifyQueue <- rMsg
+	return true
+}
+
+func (pipe *Pipeline) VerifyMetrics() Metrics {
+	return Metrics{
+		Processed: atomic.LoadUint64(&pipe._verified),
+		Failed:    atomic.LoadUint64(&pipe._verifyFailed),
+		Pending:   len(pipe._verifyQueue),
+	}
+}
+
+func (pipe *Pipeline) DecryptMetrics() Metrics {
+	return Metrics{
+		Processed: atomic.LoadUint64(&pipe._decrypted),
+		Failed:    atomic.LoadUint64(&pipe._decryptFailed),
+		Pending:   len(pipe._decryptQueue),
+	}
+}
+
+func (pipe *Pipeline) verify() {
+	defer pipe._verifyGroup.Done()
+	for rMsg := range pipe._verifyQueue {
+		sMsg, err := SafeVerify(rMsg)
+		if err != nil {
+			atomic.AddUint64(&pipe._verifyFailed, 1)
+			pipe._delegate.OnError(err, rMsg)
+			continue
+		}
+		atomic.AddUint64(&pipe._verified, 1)
+		pipe._decryptQueue <- &verifiedMessage{sMsg: sMsg, rMsg: rMsg}
+	}
+}
+
+func (pipe *Pipeline) decrypt() {
+	defer pipe._decryptGroup.Done()
+	for item := range pipe._decryptQueue {
+		iMsg, err := SafeDecrypt(item.sMsg)
+		if err != nil {
+			atomic.AddUint64(&pipe._decryptFailed, 1)
+			pipe._delegate.OnError(err, item.rMsg)
+			continue
+		}
+		atomic.AddUint64(&pipe._decrypted, 1)
+		if iMsg != nil {
+			pipe._delegate.OnMessage(iMsg, item.rMsg)
+		}
+	}
+}
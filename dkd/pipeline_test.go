@@ -0,0 +1,71 @@
+/* license: https://mit-license.org
+ *
+ *  Dao-Ke-Dao: Universal Message Module
+ *
+ *                                Written in 2022 by Moky <albert.moky@gmail.com>
+ *
+ * ==============================================================================
+ * The MIT License (MIT)
+ *
+ * Copyright (c) 2022 Albert Moky
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ * ==============================================================================
+ */
+package dkd_test
+
+import (
+	"testing"
+	"github.com/dimchat/dkd-go/dkd/pipeline"
+)
+
+func TestPipelineMetricsAndDrain(t *testing.T) {
+	good, bad := receivedMessages(t)
+	delegate := new(countingDelegate)
+	pipe := pipeline.NewPipeline(delegate, 2, 2, 8)
+	// queued before the workers start, drained on Stop
+	for i := 0; i < 3; i++ {
+		if !pipe.SubmitReliable(good) {
+			t.Fatal("failed to submit")
+		}
+	}
+	if !pipe.SubmitReliable(bad) {
+		t.Fatal("failed to submit")
+	}
+	if pending := pipe.VerifyMetrics().Pending; pending != 4 {
+		t.Fatalf("expected 4 pending, got %d", pending)
+	}
+	pipe.Start()
+	pipe.Stop()
+
+	verify, decrypt := pipe.VerifyMetrics(), pipe.DecryptMetrics()
+	if verify.Processed != 3 || verify.Failed != 1 || verify.Pending != 0 {
+		t.Fatalf("unexpected verify metrics: %+v", verify)
+	}
+	if decrypt.Processed != 3 || decrypt.Failed != 0 || decrypt.Pending != 0 {
+		t.Fatalf("unexpected decrypt metrics: %+v", decrypt)
+	}
+	if delegate.messages != 3 || delegate.errors != 1 {
+		t.Fatalf("unexpected callbacks: %d, %d", delegate.messages, delegate.errors)
+	}
+	if pipe.SubmitReliable(good) {
+		t.Fatal("submitted after stop")
+	}
+	pipe.Stop()
+}
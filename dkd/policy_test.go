@@ -0,0 +1,106 @@
+/* license: https://mit-license.org
+ *
+ *  Dao-Ke-Dao: Universal Message Module
+ *
+ *                                Written in 2022 by Moky <albert.moky@gmail.com>
+ *
+ * ==============================================================================
+ * The MIT License (MIT)
+ *
+ * Copyright (c) 2022 Albert Moky
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ * ==============================================================================
+ */
+package dkd_test
+
+import (
+	"errors"
+	"testing"
+	. "github.com/dimchat/dkd-go/dkd"
+	. "github.com/dimchat/dkd-go/protocol"
+	. "github.com/dimchat/mkm-go/types"
+)
+
+type quarantinePolicy struct{}
+
+func (policy *quarantinePolicy) Allow(_ Content, _ Envelope) Decision {
+	return QUARANTINE
+}
+
+func TestSafeDecryptPolicyDecision(t *testing.T) {
+	alice, bob := newPeer("alice@a1"), newPeer("bob@b1")
+	env := EnvelopeCreate(alice.ID(), bob.ID(), TimeNow())
+	iMsg := NewInstantMessage(nil, env, textContent("hello"))
+	iMsg.SetDelegate(alice)
+	sMsg := iMsg.Encrypt(new(testCrypto).GenerateKey(), nil)
+	sMsg.SetDelegate(bob)
+
+	ContentPolicySet(new(quarantinePolicy))
+	decrypted, err := SafeDecrypt(sMsg)
+	ContentPolicySet(nil)
+	var policyErr *PolicyError
+	if decrypted != nil || !errors.As(err, &policyErr) || policyErr.Decision != QUARANTINE {
+		t.Fatalf("expected quarantine, got: %v, %v", decrypted, err)
+	}
+}
+
+type fixedHasher struct{}
+
+func (hasher *fixedHasher) Algorithm() string {
+	return "sha256"
+}
+
+func (hasher *fixedHasher) HashMedia(_ Content) []string {
+	return []string{"abcd"}
+}
+
+type sharedDenylist struct {
+	verdict *Verdict
+}
+
+func (list *sharedDenylist) Lookup(_ string, _ string) *Verdict {
+	return list.verdict
+}
+
+func TestModerationVerdictInError(t *testing.T) {
+	alice, bob := newPeer("alice@a1"), newPeer("bob@b1")
+	env := EnvelopeCreate(alice.ID(), bob.ID(), TimeNow())
+	iMsg := NewInstantMessage(nil, env, textContent("hello"))
+	iMsg.SetDelegate(alice)
+	sMsg := iMsg.Encrypt(new(testCrypto).GenerateKey(), nil)
+	sMsg.SetDelegate(bob)
+
+	shared := &Verdict{Decision: REJECT, List: "operator"}
+	ModerationHookSet(NewHashListModerator(&sharedDenylist{shared}, new(fixedHasher)))
+	defer ModerationHookSet(nil)
+
+	_, err := SafeDecrypt(sMsg)
+	var policyErr *PolicyError
+	if !errors.As(err, &policyErr) || policyErr.Verdict == nil || policyErr.Verdict.Hash != "abcd" {
+		t.Fatalf("expected verdict in error, got: %v", err)
+	}
+	if shared.Hash != "" || shared.Algorithm != "" {
+		t.Fatalf("denylist verdict modified: %+v", shared)
+	}
+	_, err = SafeEncrypt(iMsg, new(testCrypto).GenerateKey(), nil)
+	if !errors.As(err, &policyErr) || policyErr.Decision != REJECT || policyErr.Verdict.List != "operator" {
+		t.Fatalf("expected verdict from encrypt, got: %v", err)
+	}
+}
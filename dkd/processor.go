@@ -0,0 +1,176 @@
+/* license: https://mit-license.org
+ *
+ *  Dao-Ke-Dao: Universal Message Module
+ *
+ *                                Written in 2022 by Moky <albert.moky@gmail.com>
+ *
+ * ==============================================================================
+ * The MIT License (MIT)
+ *
+ * Copyright (c) 2022 Albert Moky
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ * ==============================================================================
+ */
+package dkd
+
+import (
+	"errors"
+	"sync"
+	. "github.com/dimchat/dkd-go/protocol"
+)
+
+var ErrSignatureNotMatch = errors.New("message signature not match")
+
+/**
+ *  Processor Delegate
+ *  ~~~~~~~~~~~~~~~~~~
+ *  Callbacks from worker goroutines, must be thread-safe
+ */
+type ProcessorDelegate interface {
+
+	/**
+	 *  Callback when message verified and decrypted
+	 *
+	 * @param iMsg - decrypted message
+	 * @param rMsg - received message
+	 */
+	OnMessage(iMsg InstantMessage, rMsg ReliableMessage)
+
+	/**
+	 *  Callback when message failed to verify/decrypt,
+	 *  ErrRateLimited means the message can be submitted again later,
+	 *  *PolicyError means the content policy rejected or quarantined it
+	 *
+	 * @param err  - error
+	 * @param rMsg - received message
+	 */
+	OnError(err error, rMsg ReliableMessage)
+}
+
+/**
+ *  Message Processor
+ *  ~~~~~~~~~~~~~~~~~
+ *  Verify & decrypt reliable messages on a pool of workers,
+ *  with a bounded queue for backpressure.
+ */
+type Processor struct {
+
+	_delegate ProcessorDelegate
+	_workers int
+
+	_queue chan ReliableMessage
+	_group sync.WaitGroup
+	_stopped bool
+
+	_lock sync.RWMutex
+}
+
+func NewProcessor(delegate ProcessorDelegate, workers int, queueSize int) *Processor {
+	processor := new(Processor)
+	processor.Init(delegate, workers, queueSize)
+	return processor
+}
+
+func (processor *Processor) Init(delegate ProcessorDelegate, workers int, queueSize int) *Processor {
+	if workers < 1 {
+		workers = 1
+	}
+	processor._delegate = delegate
+	processor._workers = workers
+	processor._queue = make(chan ReliableMessage, queueSize)
+	return processor
+}
+
+func (processor *Processor) Start() {
+	for i := 0; i < processor._workers; i++ {
+		processor._group.Add(1)
+		go processor.run()
+	}
+}
+
+/**
+ *  Stop accepting messages, and wait for the queued ones to finish
+ */
+func (processor *Processor) Stop() {
+	// wait for the blocked submitters
+	processor._lock.Lock()
+	if !processor._stopped {
+		processor._stopped = true
+		close(processor._queue)
+	}
+	processor._lock.Unlock()
+	processor._group.Wait()
+}
+
+/**
+ *  Submit message, block when the queue is full
+ *
+ * @param rMsg - received message
+ * @return false when stopped
+ */
+func (processor *Processor) SubmitReliable(rMsg ReliableMessage) bool {
+	processor._lock.RLock()
+	defer processor._lock.RUnlock()
+	if processor._stopped {
+		return false
+	}
+	processor._queue <- rMsg
+	return true
+}
+
+/**
+ *  Submit message without blocking
+ *
+ * @param rMsg - received message
+ * @return false when the queue is full or stopped
+ */
+func (processor *Processor) TrySubmitReliable(rMsg ReliableMessage) bool {
+	processor._lock.RLock()
+	defer processor._lock.RUnlock()
+	if processor._stopped {
+		return false
+	}
+	select {
+	case processor._queue <- rMsg:
+		return true
+	default:
+		return false
+	}
+}
+
+func (processor *Processor) run() {
+	defer processor._group.Done()
+	for rMsg := range processor._queue {
+		iMsg, err := processReliable(rMsg)
+		if err != nil {
+			processor._delegate.OnError(err, rMsg)
+		} else if iMsg != nil {
+			processor._delegate.OnMessage(iMsg, rMsg)
+		}
+	}
+}
+
+func processReliable(rMsg ReliableMessage) (iMsg InstantMessage, err error) {
+	sMsg, err := SafeVerify(rMsg)
+	if err != nil {
+		return nil, err
+	}
+	return SafeDecrypt(sMsg)
+}
@@ -0,0 +1,95 @@
+/* license: https://mit-license.org
+ *
+ *  Dao-Ke-Dao: Universal Message Module
+ *
+ *                                Written in 2022 by Moky <albert.moky@gmail.com>
+ *
+ * ==============================================================================
+ * The MIT License (MIT)
+ *
+ * Copyright (c) 2022 Albert Moky
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ * ==============================================================================
+ */
+package dkd_test
+
+import (
+	"sync"
+	"testing"
+	. "github.com/dimchat/dkd-go/dkd"
+	. "github.com/dimchat/dkd-go/protocol"
+	. "github.com/dimchat/mkm-go/types"
+)
+
+type countingDelegate struct {
+	messages int
+	errors int
+
+	_lock sync.Mutex
+}
+
+func (delegate *countingDelegate) OnMessage(_ InstantMessage, _ ReliableMessage) {
+	delegate._lock.Lock()
+	defer delegate._lock.Unlock()
+	delegate.messages++
+}
+
+func (delegate *countingDelegate) OnError(_ error, _ ReliableMessage) {
+	delegate._lock.Lock()
+	defer delegate._lock.Unlock()
+	delegate.errors++
+}
+
+// signed message for bob, and a copy with the signature broken
+func receivedMessages(t *testing.T) (ReliableMessage, ReliableMessage) {
+	alice, bob := newPeer("alice@a1"), newPeer("bob@b1")
+	env := EnvelopeCreate(alice.ID(), bob.ID(), TimeNow())
+	iMsg := NewInstantMessage(nil, env, textContent("hello"))
+	iMsg.SetDelegate(alice)
+	info := iMsg.Encrypt(new(testCrypto).GenerateKey(), nil).Sign().CopyMap(false)
+	good := ReliableMessageParse(CopyMap(info))
+	good.SetDelegate(bob)
+	info["data"] = info["data"].(string) + "AAAA"
+	bad := ReliableMessageParse(info)
+	bad.SetDelegate(bob)
+	if good == nil || bad == nil {
+		t.Fatal("failed to build messages")
+	}
+	return good, bad
+}
+
+func TestProcessorSubmitAfterStop(t *testing.T) {
+	good, bad := receivedMessages(t)
+	delegate := new(countingDelegate)
+	processor := NewProcessor(delegate, 2, 4)
+	processor.Start()
+	if !processor.SubmitReliable(good) || !processor.TrySubmitReliable(bad) {
+		t.Fatal("failed to submit")
+	}
+	processor.Stop()
+	if delegate.messages != 1 || delegate.errors != 1 {
+		t.Fatalf("queued messages not drained: %d, %d", delegate.messages, delegate.errors)
+	}
+	if processor.SubmitReliable(good) || processor.TrySubmitReliable(good) {
+		t.Fatal("submitted after stop")
+	}
+	// stop twice
+	processor.Stop()
+}
@@ -0,0 +1,83 @@
+/* license: https://mit-license.org
+ *
+ *  Dao-Ke-Dao: Universal Message Module
+ *
+ *                                Written in 2022 by Moky <albert.moky@gmail.com>
+ *
+ * ==============================================================================
+ * The MIT License (MIT)
+ *
+ * Copyright (c) 2022 Albert Moky
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ * ==============================================================================
+ */
+package dkd
+
+import (
+	. "github.com/dimchat/dkd-go/protocol"
+	. "github.com/dimchat/mkm-go/types"
+)
+
+/**
+ *  Push Info
+ *  ~~~~~~~~~
+ *  Notification-safe fields of a message for push gateways,
+ *  never contains the content or any plaintext of it.
+ */
+type PushInfo struct {
+	Sender      string `json:"sender"`
+	Receiver    string `json:"receiver"`
+	Group       string `json:"group,omitempty"`
+	Type        uint8  `json:"type,omitempty"`        // 0 when not exposed in envelope
+	Alias       string `json:"alias,omitempty"`       // alias of the type, e.g.: "TEXT"
+	Time        int64  `json:"time,omitempty"`        // seconds
+	Fingerprint string `json:"fingerprint"`           // for collapsing duplicated pushes
+	Preview     string `json:"preview,omitempty"`     // encrypted by sender, decrypt on device
+}
+
+/**
+ *  Extract push info from the message
+ *
+ *  Only envelope fields are used, the content stays encrypted; the preview
+ *  slot is filled when the sender attached one for the receiver's device
+ *  (see ReliableMessageGetPreview).
+ *
+ * @param rMsg - network message
+ * @return push info
+ */
+func PushSummary(rMsg ReliableMessage) PushInfo {
+	info := PushInfo{
+		Sender:      idString(rMsg.Sender()),
+		Receiver:    idString(rMsg.Receiver()),
+		Fingerprint: MessageFingerprint(rMsg),
+		Preview:     ReliableMessageGetPreview(rMsg.Map()),
+	}
+	if group := rMsg.Group(); group != nil {
+		info.Group = group.String()
+	}
+	if msgType := rMsg.Type(); msgType != 0 {
+		info.Type = uint8(msgType)
+		info.Alias = ContentTypeGetAlias(msgType)
+	}
+	if when := rMsg.Time(); !TimeIsNil(when) {
+		info.Time = when.Unix()
+	}
+	return info
+}
@@ -0,0 +1,182 @@
+/* license: https://mit-license.org
+ *
+ *  Dao-Ke-Dao: Universal Message Module
+ *
+ *                                Written in 2022 by Moky <albert.moky@gmail.com>
+ *
+ * ==============================================================================
+ * The MIT License (MIT)
+ *
+ * Copyright (c) 2022 Albert Moky
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ * ==============================================================================
+ */
+package dkd
+
+import (
+	"errors"
+	"sync"
+	"time"
+	. "github.com/dimchat/dkd-go/protocol"
+	. "github.com/dimchat/mkm-go/types"
+)
+
+/**
+ *  Quarantined Message
+ *  ~~~~~~~~~~~~~~~~~~~
+ *  Secure message failed to decrypt, waiting to retry
+ */
+type QuarantinedMessage struct {
+	Message   SecureMessage
+	Error     error
+	Attempts  int
+	NextRetry Time
+}
+
+/**
+ *  Retry Delegate
+ *  ~~~~~~~~~~~~~~
+ */
+type RetryDelegate interface {
+
+	/**
+	 *  Callback when quarantined message decrypted
+	 *
+	 * @param iMsg - decrypted message
+	 * @param sMsg - quarantined message
+	 */
+	OnDecrypted(iMsg InstantMessage, sMsg SecureMessage)
+
+	/**
+	 *  Callback when quarantined message decrypted, but not delivered
+	 *  by content policy; it's removed from the retry queue
+	 *
+	 * @param err  - policy decision (REJECT or QUARANTINE)
+	 * @param sMsg - quarantined message
+	 */
+	OnPolicyDecision(err *PolicyError, sMsg SecureMessage)
+}
+
+/**
+ *  Retry Manager
+ *  ~~~~~~~~~~~~~
+ *  Holds the quarantined messages and re-attempts decrypting them
+ *  when due, or when the key cache signals updates.
+ */
+type RetryManager struct {
+
+	_delegate RetryDelegate
+	_interval time.Duration
+
+	_messages []*QuarantinedMessage
+	_lock sync.Mutex
+}
+
+func NewRetryManager(delegate RetryDelegate, interval time.Duration) *RetryManager {
+	manager := new(RetryManager)
+	manager.Init(delegate, interval)
+	return manager
+}
+
+func (manager *RetryManager) Init(delegate RetryDelegate, interval time.Duration) *RetryManager {
+	manager._delegate = delegate
+	manager._interval = interval
+	manager._messages = make([]*QuarantinedMessage, 0)
+	return manager
+}
+
+func (manager *RetryManager) Messages() []*QuarantinedMessage {
+	manager._lock.Lock()
+	defer manager._lock.Unlock()
+	messages := make([]*QuarantinedMessage, len(manager._messages))
+	copy(messages, manager._messages)
+	return messages
+}
+
+/**
+ *  Put a message which failed to decrypt into quarantine
+ *
+ * @param sMsg - secure message
+ * @param err  - decrypt error
+ * @return quarantined message
+ */
+func (manager *RetryManager) Quarantine(sMsg SecureMessage, err error) *QuarantinedMessage {
+	qMsg := &QuarantinedMessage{
+		Message:   sMsg,
+		Error:     err,
+		Attempts:  1,
+		NextRetry: time.Now().Add(manager._interval),
+	}
+	manager._lock.Lock()
+	manager._messages = append(manager._messages, qMsg)
+	manager._lock.Unlock()
+	return qMsg
+}
+
+/**
+ *  Called by key cache when new keys arrived, retry all messages
+ */
+func (manager *RetryManager) KeysUpdated() {
+	manager.retry(nil)
+}
+
+/**
+ *  Retry the messages which next retry time is up
+ *
+ * @param now - current time
+ */
+func (manager *RetryManager) RetryDue(now Time) {
+	manager.retry(now)
+}
+
+func (manager *RetryManager) retry(now Time) {
+	manager._lock.Lock()
+	messages := manager._messages
+	manager._messages = make([]*QuarantinedMessage, 0, len(messages))
+	manager._lock.Unlock()
+
+	remaining := make([]*QuarantinedMessage, 0, len(messages))
+	for _, qMsg := range messages {
+		if now != nil && qMsg.NextRetry.UnixNano() > now.UnixNano() {
+			// not due yet
+			remaining = append(remaining, qMsg)
+			continue
+		}
+		iMsg, err := SafeDecrypt(qMsg.Message)
+		var policyErr *PolicyError
+		if errors.As(err, &policyErr) {
+			// decrypted, no need to retry
+			manager._delegate.OnPolicyDecision(policyErr, qMsg.Message)
+		} else if err != nil {
+			// failed again, wait longer
+			qMsg.Error = err
+			qMsg.Attempts++
+			delay := manager._interval * time.Duration(qMsg.Attempts)
+			qMsg.NextRetry = time.Now().Add(delay)
+			remaining = append(remaining, qMsg)
+		} else if iMsg != nil {
+			manager._delegate.OnDecrypted(iMsg, qMsg.Message)
+		}
+	}
+
+	manager._lock.Lock()
+	manager._messages = append(manager._messages, remaining...)
+	manager._lock.Unlock()
+}
@@ -0,0 +1,277 @@
+/* license: https://mit-license.org
+ *
+ *  Dao-Ke-Dao: Universal Message Module
+ *
+ *                                Written in 2022 by Moky <albert.moky@gmail.com>
+ *
+ * ==============================================================================
+ * The MIT License (MIT)
+ *
+ * Copyright (c) 2022 Albert Moky
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ * ==============================================================================
+ */
+package queue
+
+import (
+	"bufio"
+	"container/heap"
+	"encoding/json"
+	"os"
+	"sort"
+	"sync"
+	"time"
+	. "github.com/dimchat/dkd-go/dkd"
+	. "github.com/dimchat/dkd-go/protocol"
+)
+
+/**
+ *  Station Queue
+ *  ~~~~~~~~~~~~~
+ *  Priority queue of in-flight reliable messages,
+ *  higher priority first, FIFO for the same priority;
+ *  expired messages are dropped.
+ *
+ *  Snapshot() writes the queue to disk atomically (temporary file + rename),
+ *  Restore() loads it back on restart.
+ */
+type Queue struct {
+
+	_items itemHeap
+	_seq uint64
+
+	_lock sync.Mutex
+}
+
+type item struct {
+	msg ReliableMessage
+	priority int
+	expires int64  // unix nanoseconds; 0 for never
+	seq uint64
+}
+
+// snapshot record, one JsON object per line
+type record struct {
+	Priority int                    `json:"priority"`
+	Expires  int64                  `json:"expires,omitempty"`  // unix milliseconds
+	Message  map[string]interface{} `json:"msg"`
+}
+
+func NewQueue() *Queue {
+	queue := new(Queue)
+	queue.Init()
+	return queue
+}
+
+func (queue *Queue) Init() *Queue {
+	queue._items = make(itemHeap, 0)
+	queue._seq = 0
+	return queue
+}
+
+func (queue *Queue) Len() int {
+	queue._lock.Lock()
+	defer queue._lock.Unlock()
+	return queue._items.Len()
+}
+
+/**
+ *  Append message
+ *
+ * @param rMsg     - message to deliver
+ * @param priority - higher first
+ * @param expires  - drop the message after this time; zero for never
+ */
+func (queue *Queue) Push(rMsg ReliableMessage, priority int, expires time.Time) {
+	var deadline int64
+	if !expires.IsZero() {
+		deadline = expires.UnixNano()
+	}
+	queue._lock.Lock()
+	defer queue._lock.Unlock()
+	queue.push(rMsg, priority, deadline)
+}
+
+// call with lock
+func (queue *Queue) push(rMsg ReliableMessage, priority int, expires int64) {
+	queue._seq++
+	heap.Push(&queue._items, &item{msg: rMsg, priority: priority, expires: expires, seq: queue._seq})
+}
+
+/**
+ *  Take the message with highest priority, skip expired ones
+ *
+ * @param now - current time
+ * @return nil on empty
+ */
+func (queue *Queue) Pop(now time.Time) ReliableMessage {
+	queue._lock.Lock()
+	defer queue._lock.Unlock()
+	for queue._items.Len() > 0 {
+		next := heap.Pop(&queue._items).(*item)
+		if next.expires == 0 || next.expires > now.UnixNano() {
+			return next.msg
+		}
+	}
+	return nil
+}
+
+/**
+ *  Remove expired messages
+ *
+ * @return count of removed messages
+ */
+func (queue *Queue) Purge(now time.Time) int {
+	deadline := now.UnixNano()
+	queue._lock.Lock()
+	defer queue._lock.Unlock()
+	remaining := make(itemHeap, 0, queue._items.Len())
+	for _, next := range queue._items {
+		if next.expires == 0 || next.expires > deadline {
+			remaining = append(remaining, next)
+		}
+	}
+	count := queue._items.Len() - remaining.Len()
+	heap.Init(&remaining)
+	queue._items = remaining
+	return count
+}
+
+/**
+ *  Save all messages to file atomically
+ *
+ * @param path - snapshot file
+ */
+func (queue *Queue) Snapshot(path string) error {
+	// copy items to release the lock before I/O
+	queue._lock.Lock()
+	items := make([]*item, queue._items.Len())
+	copy(items, queue._items)
+	queue._lock.Unlock()
+	// keep the popping order in file
+	sort.Slice(items, itemHeap(items).Less)
+
+	temp := path + ".tmp"
+	file, err := os.OpenFile(temp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	writer := bufio.NewWriter(file)
+	for _, next := range items {
+		rec := record{Priority: next.priority, Message: next.msg.Map()}
+		if next.expires > 0 {
+			rec.Expires = next.expires / int64(time.Millisecond)
+		}
+		var line []byte
+		if line, err = json.Marshal(rec); err == nil {
+			_, err = writer.Write(append(line, '\n'))
+		}
+		if err != nil {
+			break
+		}
+	}
+	if err == nil {
+		err = writer.Flush()
+	}
+	if err == nil {
+		err = file.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(temp)
+		return err
+	}
+	return os.Rename(temp, path)
+}
+
+/**
+ *  Load messages from snapshot file, expired ones are dropped
+ *
+ * @param path - snapshot file
+ * @param now  - current time
+ * @return count of restored messages
+ */
+func (queue *Queue) Restore(path string, now time.Time) (int, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64 * 1024), 16 * 1024 * 1024)
+	count := 0
+	queue._lock.Lock()
+	defer queue._lock.Unlock()
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+		var rec record
+		if err = json.Unmarshal(line, &rec); err != nil {
+			return count, err
+		}
+		expires := rec.Expires * int64(time.Millisecond)
+		if expires > 0 && expires <= now.UnixNano() {
+			continue
+		}
+		rMsg, err := SafeParse(rec.Message)
+		if err != nil {
+			// skip broken message
+			continue
+		}
+		queue.push(rMsg, rec.Priority, expires)
+		count++
+	}
+	return count, scanner.Err()
+}
+
+// max-heap by priority, then FIFO
+type itemHeap []*item
+
+func (items itemHeap) Len() int {
+	return len(items)
+}
+
+func (items itemHeap) Less(i, j int) bool {
+	if items[i].priority != items[j].priority {
+		return items[i].priority > items[j].priority
+	}
+	return items[i].seq < items[j].seq
+}
+
+func (items itemHeap) Swap(i, j int) {
+	items[i], items[j] = items[j], items[i]
+}
+
+func (items *itemHeap) Push(x interface{}) {
+	*items = append(*items, x.(*item))
+}
+
+func (items *itemHeap) Pop() interface{} {
+	old := *items
+	n := len(old)
+	last := old[n - 1]
+	old[n - 1] = nil
+	*items = old[:n - 1]
+	return last
+}
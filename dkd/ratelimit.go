@@ -0,0 +1,130 @@
+/* license: https://mit-license.org
+ *
+ *  Dao-Ke-Dao: Universal Message Module
+ *
+ *                                Written in 2022 by Moky <albert.moky@gmail.com>
+ *
+ * ==============================================================================
+ * The MIT License (MIT)
+ *
+ * Copyright (c) 2022 Albert Moky
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ * ==============================================================================
+ */
+package dkd
+
+import (
+	"errors"
+	"sync"
+	"time"
+	. "github.com/dimchat/mkm-go/protocol"
+)
+
+var ErrRateLimited = errors.New("message sender exceeds rate limit")
+
+// implemented by RelayMessage
+type rateLimited interface {
+	RateLimited() bool
+}
+
+func isRateLimited(rMsg interface{}) bool {
+	limited, ok := rMsg.(rateLimited)
+	return ok && limited.RateLimited()
+}
+
+/**
+ *  Token Bucket Rate Limiter
+ *  ~~~~~~~~~~~~~~~~~~~~~~~~~
+ *  Each sender has a bucket holding up to 'burst' tokens,
+ *  refilled by 'rate' tokens per second; one verification takes one token.
+ *
+ *  Call Sweep() periodically to drop buckets of idle senders.
+ */
+type TokenBucketLimiter struct {
+	_rate float64
+	_burst float64
+
+	_buckets map[string]*tokenBucket
+	_lock sync.Mutex
+}
+
+type tokenBucket struct {
+	tokens float64
+	updated time.Time
+}
+
+func NewTokenBucketLimiter(rate float64, burst int) *TokenBucketLimiter {
+	limiter := new(TokenBucketLimiter)
+	limiter.Init(rate, burst)
+	return limiter
+}
+
+func (limiter *TokenBucketLimiter) Init(rate float64, burst int) *TokenBucketLimiter {
+	limiter._rate = rate
+	limiter._burst = float64(burst)
+	limiter._buckets = make(map[string]*tokenBucket)
+	return limiter
+}
+
+//-------- IRateLimiter
+
+func (limiter *TokenBucketLimiter) Allow(sender ID) bool {
+	now := time.Now()
+	key := sender.String()
+	limiter._lock.Lock()
+	defer limiter._lock.Unlock()
+	bucket := limiter._buckets[key]
+	if bucket == nil {
+		bucket = &tokenBucket{tokens: limiter._burst, updated: now}
+		limiter._buckets[key] = bucket
+	} else {
+		// refill
+		bucket.tokens += now.Sub(bucket.updated).Seconds() * limiter._rate
+		if bucket.tokens > limiter._burst {
+			bucket.tokens = limiter._burst
+		}
+		bucket.updated = now
+	}
+	if bucket.tokens < 1 {
+		return false
+	}
+	bucket.tokens--
+	return true
+}
+
+/**
+ *  Remove buckets not used for a while
+ *
+ * @param idle - idle duration
+ * @return count of removed buckets
+ */
+func (limiter *TokenBucketLimiter) Sweep(idle time.Duration) int {
+	expires := time.Now().Add(-idle)
+	limiter._lock.Lock()
+	defer limiter._lock.Unlock()
+	count := 0
+	for key, bucket := range limiter._buckets {
+		if bucket.updated.Before(expires) {
+			delete(limiter._buckets, key)
+			count++
+		}
+	}
+	return count
+}
@@ -0,0 +1,111 @@
+/* license: https://mit-license.org
+ *
+ *  Dao-Ke-Dao: Universal Message Module
+ *
+ *                                Written in 2022 by Moky <albert.moky@gmail.com>
+ *
+ * ==============================================================================
+ * The MIT License (MIT)
+ *
+ * Copyright (c) 2022 Albert Moky
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ * ==============================================================================
+ */
+package dkd
+
+import (
+	"encoding/hex"
+	"strings"
+	. "github.com/dimchat/dkd-go/protocol"
+	. "github.com/dimchat/mkm-go/digest"
+	. "github.com/dimchat/mkm-go/protocol"
+	. "github.com/dimchat/mkm-go/types"
+)
+
+// shorter prefixes are too easy to collide
+const minReceiptPrefix = 8
+
+/**
+ *  Match receipt with the sent message
+ *  ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+ *  Receipt content (from the core layer) refers to the original message
+ *  with fields in 'origin', or in the content itself for old versions:
+ *
+ *      'sender', 'receiver', 'time' - original envelope
+ *      'sn'        - original serial number
+ *      'signature' - original signature, or its prefix
+ *      'digest'    - hex(sha256(original 'data')), or its prefix
+ *
+ *  'sn' can't be read from the encrypted message, so the caller passes
+ *  the one it recorded; it must match, and as 'sn' alone may collide,
+ *  the signature/digest prefix must match too when present (a prefix
+ *  shorter than 8 chars never matches); envelope fields must not
+ *  contradict the sent message.
+ *
+ *  Only the fields above are read, the receipt content types themselves
+ *  are still defined by the core layer.
+ *
+ * @param receipt - receipt content
+ * @param sent    - original message
+ * @param sn      - serial number of the original content
+ * @return true on matched
+ */
+func MatchReceipt(receipt Content, sent ReliableMessage, sn uint64) bool {
+	origin, ok := receipt.Get("origin").(map[string]interface{})
+	if !ok {
+		origin = receipt.Map()
+	}
+	// 1. check serial number
+	if sn == 0 || ContentGetSN(origin) != sn {
+		return false
+	}
+	// 2. check envelope
+	if !matchID(origin["sender"], sent.Sender()) || !matchID(origin["receiver"], sent.Receiver()) {
+		return false
+	}
+	when := EnvelopeGetTime(origin)
+	if !TimeIsNil(when) && when.Unix() != sent.Time().Unix() {
+		return false
+	}
+	// 3. check signature prefix
+	if prefix, ok := origin["signature"].(string); ok {
+		signature, _ := sent.Get("signature").(string)
+		if len(prefix) < minReceiptPrefix || !strings.HasPrefix(signature, prefix) {
+			return false
+		}
+	}
+	// 4. check data digest prefix
+	if prefix, ok := origin["digest"].(string); ok {
+		data, _ := sent.Get("data").(string)
+		digest := hex.EncodeToString(SHA256([]byte(data)))
+		if len(prefix) < minReceiptPrefix || !strings.HasPrefix(digest, strings.ToLower(prefix)) {
+			return false
+		}
+	}
+	return true
+}
+
+func matchID(value interface{}, expected ID) bool {
+	if value == nil {
+		return true
+	}
+	id := IDParse(value)
+	return id != nil && id.Equal(expected)
+}
@@ -0,0 +1,89 @@
+/* license: https://mit-license.org
+ *
+ *  Dao-Ke-Dao: Universal Message Module
+ *
+ *                                Written in 2022 by Moky <albert.moky@gmail.com>
+ *
+ * ==============================================================================
+ * The MIT License (MIT)
+ *
+ * Copyright (c) 2022 Albert Moky
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ * ==============================================================================
+ */
+package dkd
+
+import (
+	. "github.com/dimchat/dkd-go/protocol"
+	. "github.com/dimchat/mkm-go/format"
+	. "github.com/dimchat/mkm-go/protocol"
+	. "github.com/dimchat/mkm-go/types"
+)
+
+/**
+ *  Relay Envelope
+ *  ~~~~~~~~~~~~~~
+ *  Routing view of a reliable message for stations,
+ *  only the routing fields and the opaque payload are exposed,
+ *  so the key material ('key'/'keys') cannot be accessed from here.
+ */
+type RelayEnvelope struct {
+
+	_msg ReliableMessage
+}
+
+func NewRelayEnvelope(rMsg ReliableMessage) *RelayEnvelope {
+	env := new(RelayEnvelope)
+	env._msg = rMsg
+	return env
+}
+
+func (env *RelayEnvelope) Sender() ID {
+	return env._msg.Sender()
+}
+
+func (env *RelayEnvelope) Receiver() ID {
+	return env._msg.Receiver()
+}
+
+func (env *RelayEnvelope) Group() ID {
+	return env._msg.Group()
+}
+
+func (env *RelayEnvelope) Type() ContentType {
+	return env._msg.Type()
+}
+
+func (env *RelayEnvelope) Time() Time {
+	return env._msg.Time()
+}
+
+/**
+ *  Get the opaque payload for forwarding
+ *
+ * @return raw bytes of 'data' (base64 decoded, same as hybrid frames)
+ */
+func (env *RelayEnvelope) Payload() []byte {
+	b64, _ := env._msg.Get("data").(string)
+	if b64 == "" {
+		return nil
+	}
+	return Base64Decode(b64)
+}
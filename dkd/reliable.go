@@ -31,8 +31,11 @@
 package dkd
 
 import (
+	"strconv"
+	"time"
 	. "github.com/dimchat/dkd-go/protocol"
 	. "github.com/dimchat/mkm-go/protocol"
+	. "github.com/dimchat/mkm-go/types"
 )
 
 /**
@@ -60,14 +63,46 @@ type RelayMessage struct {
 	EncryptedMessage
 
 	_signature []byte
+	_signaturePooled bool  // borrowed from buffer pool
 
 	_meta Meta
 	_visa Visa
+
+	// verification outcome
+	_memo *verifyMemo
+	_limited bool  // last Verify rejected by rate limiter
+}
+
+// inputs & outcome of the last verification
+type verifyMemo struct {
+	sender string
+	data string
+	signature string
+	aad string  // envelope fields covered by the signature, see memoAAD()
+	ok bool
+}
+
+func (memo *verifyMemo) match(msg *RelayMessage) bool {
+	sender, _ := msg.Get("sender").(string)
+	data, _ := msg.Get("data").(string)
+	signature, _ := msg.Get("signature").(string)
+	return memo.sender == sender && memo.data == data && memo.signature == signature &&
+		memo.aad == memoAAD(msg)
+}
+
+// AAD version & bytes, empty for message without AAD
+func memoAAD(msg *RelayMessage) string {
+	version := SecureMessageGetAAD(msg.Map())
+	if version == 0 {
+		return ""
+	}
+	return strconv.Itoa(version) + ":" + string(MessageBuildAAD(msg.Map(), version))
 }
 
 func NewReliableMessage(dict map[string]interface{}) ReliableMessage {
 	msg := new(RelayMessage)
 	msg.Init(dict)
+	trackSecrets(msg)
 	return msg
 }
 
@@ -75,9 +110,12 @@ func (msg *RelayMessage) Init(dict map[string]interface{}) ReliableMessage {
 	if msg.EncryptedMessage.Init(dict) != nil {
 		// lazy load
 		msg._signature = nil
+		msg._signaturePooled = false
 
 		msg._meta = nil
 		msg._visa = nil
+
+		msg._memo = nil
 	}
 	return msg
 }
@@ -87,14 +125,47 @@ func (msg *RelayMessage) Init(dict map[string]interface{}) ReliableMessage {
 func (msg *RelayMessage) Signature() []byte {
 	if msg._signature == nil {
 		base64 := msg.Get("signature")
-		msg._signature = msg.Delegate().DecodeSignature(base64, msg)
+		delegate := msg.RequireDelegate()
+		if decoder, ok := bufferedDataDecoder(delegate); ok {
+			msg._signature = decoder.DecodeSignatureInto(borrowBuffer(), base64, msg)
+			msg._signaturePooled = msg._signature != nil
+		} else {
+			msg._signature = delegate.DecodeSignature(base64, msg)
+		}
 	}
 	return msg._signature
 }
 
+// drop decoded 'signature', it will be reloaded from the map
+func (msg *RelayMessage) resetSignature() {
+	if msg._signaturePooled {
+		returnBuffer(msg._signature)
+		msg._signaturePooled = false
+	}
+	msg._signature = nil
+}
+
+func (msg *RelayMessage) Wipe() {
+	msg.EncryptedMessage.Wipe()
+	msg.resetSignature()
+}
+
+// return the pooled buffers after verification finished
+func (msg *RelayMessage) releaseBuffers() {
+	if msg._signaturePooled {
+		msg.resetSignature()
+	}
+	msg.EncryptedMessage.releaseBuffers()
+}
+
 func (msg *RelayMessage) Meta() Meta {
 	if msg._meta == nil {
-		msg._meta = ReliableMessageGetMeta(msg.Map())
+		meta := ReliableMessageGetMeta(msg.Map())
+		policy := HandshakePolicyGet()
+		if meta != nil && policy != nil && !policy.AcceptMeta(meta, msg) {
+			return nil
+		}
+		msg._meta = meta
 	}
 	return msg._meta
 }
@@ -106,7 +177,12 @@ func (msg *RelayMessage) SetMeta(meta Meta) {
 
 func (msg *RelayMessage) Visa() Visa {
 	if msg._visa == nil {
-		msg._visa = ReliableMessageGetVisa(msg.Map())
+		visa := ReliableMessageGetVisa(msg.Map())
+		policy := HandshakePolicyGet()
+		if visa != nil && policy != nil && !policy.AcceptVisa(visa, msg) {
+			return nil
+		}
+		msg._visa = visa
 	}
 	return msg._visa
 }
@@ -116,6 +192,33 @@ func (msg *RelayMessage) SetVisa(visa Visa) {
 	msg._visa = visa
 }
 
+func (msg *RelayMessage) Attachment(name string) map[string]interface{} {
+	return ReliableMessageGetAttachment(msg.Map(), name)
+}
+
+func (msg *RelayMessage) SetAttachment(name string, doc Mapper) error {
+	err := ReliableMessageSetAttachment(msg.Map(), name, doc)
+	if err == nil {
+		// reload typed attachments
+		msg._meta = nil
+		msg._visa = nil
+	}
+	return err
+}
+
+func (msg *RelayMessage) PlausibleSignature() bool {
+	return SignaturePlausible(msg.Signature(), msg.Map())
+}
+
+/**
+ *  Check whether the last Verify() was rejected by the rate limiter
+ *
+ * @return true when the sender exceeded the rate limit
+ */
+func (msg *RelayMessage) RateLimited() bool {
+	return msg._limited
+}
+
 /*
  *  Verify the Reliable Message to Secure Message
  *
@@ -131,28 +234,104 @@ func (msg *RelayMessage) SetVisa(visa Visa) {
  */
 
 /**
- *  Verify 'data' and 'signature' field with sender's public key
+ *  Verify 'data' and 'signature' field with sender's public key,
+ *  the outcome is memorized until 'sender', 'data', 'signature' or the
+ *  fields bound by AAD ('receiver'/'group', 'time') changed,
+ *  so it's cheap to call Verify again;
+ *  returns nil when the sender exceeds the rate limit (RateLimiterSet),
+ *  check RateLimited() or call SafeVerify() to tell it from a bad signature
  *
  * @return SecureMessage object
  */
 func (msg *RelayMessage) Verify() SecureMessage {
-	data := msg.EncryptedData()
-	if data == nil {
-		panic("failed to decode content data")
+	if msg._memo == nil || !msg._memo.match(msg) {
+		if msg._memo != nil {
+			// fields changed since last verification, reload them
+			msg._env = nil
+			msg.resetData()
+			msg.resetSignature()
+		}
+		limiter := RateLimiterGet()
+		msg._limited = limiter != nil && !limiter.Allow(msg.Sender())
+		if msg._limited {
+			// too many verifications for this sender,
+			// reject without memorizing, it can be retried later
+			return nil
+		}
+		msg._memo = msg.verify()
+		if store := KeyPinStoreGet(); store != nil && msg._memo.ok {
+			// check the attached visa after signature verified,
+			// so forged messages can't pin their keys
+			msg._memo.ok = msg.checkPinnedKey(store)
+		}
 	}
-	signature := msg.Signature()
-	if signature == nil {
-		panic("failed to decode message signature")
-	}
-	sender := msg.Sender()
-	// 1. verify data signature with sender's public key
-	if msg.Delegate().VerifyDataSignature(data, signature, sender, msg) {
+	if msg._memo.ok {
 		// 2. pack message
 		info := msg.CopyMap(false)
 		delete(info, "signature")
-		return SecureMessageParse(info)
+		sMsg := SecureMessageParse(info)
+		if sMsg != nil {
+			msg.propagateDelegate(sMsg)
+		}
+		return sMsg
 	} else {
 		//panic("message signature not match")
 		return nil
 	}
 }
+
+// check the key in attached visa with the pinned one
+func (msg *RelayMessage) checkPinnedKey(store KeyPinStore) bool {
+	visa := msg.Visa()
+	if visa == nil || visa.Key() == nil {
+		// no new key
+		return true
+	}
+	current := KeyFingerprint(visa.Key())
+	sender := msg.Sender()
+	pinned := store.PinnedKey(sender)
+	if pinned == current {
+		return true
+	} else if pinned != "" && !store.KeyChanged(&KeyChangedEvent{
+		Sender: sender,
+		Pinned: pinned,
+		Current: current,
+		Message: msg,
+	}) {
+		return false
+	}
+	store.PinKey(sender, current)
+	return true
+}
+
+func (msg *RelayMessage) verify() *verifyMemo {
+	memo := &verifyMemo{}
+	memo.sender, _ = msg.Get("sender").(string)
+	memo.data, _ = msg.Get("data").(string)
+	memo.signature, _ = msg.Get("signature").(string)
+	memo.aad = memoAAD(msg)
+	// decoded buffers are only needed while verifying
+	defer msg.releaseBuffers()
+	if !msg.PlausibleSignature() {
+		// reject garbage before decoding data & verifying,
+		// still logged, forged signatures are what the audit is for
+		if auditEnabled {
+			auditVerify(msg.Sender(), msg.Signature(), false, 0)
+		}
+		return memo
+	}
+	data := msg.EncryptedData()
+	if data == nil {
+		panic("failed to decode content data")
+	}
+	signature := msg.Signature()
+	sender := msg.Sender()
+	// 1. verify data signature with sender's public key
+	start := time.Now()
+	ok := msg.RequireDelegate().VerifyDataSignature(signedData(msg), signature, sender, msg)
+	if auditEnabled {
+		auditVerify(sender, signature, ok, time.Since(start))
+	}
+	memo.ok = ok
+	return memo
+}
@@ -0,0 +1,67 @@
+/* license: https://mit-license.org
+ *
+ *  Dao-Ke-Dao: Universal Message Module
+ *
+ *                                Written in 2022 by Moky <albert.moky@gmail.com>
+ *
+ * ==============================================================================
+ * The MIT License (MIT)
+ *
+ * Copyright (c) 2022 Albert Moky
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ * ==============================================================================
+ */
+package dkd_test
+
+import (
+	"testing"
+	"testing/quick"
+	"github.com/dimchat/dkd-go/dkd/sim"
+	. "github.com/dimchat/dkd-go/protocol"
+	. "github.com/dimchat/mkm-go/protocol"
+	. "github.com/dimchat/mkm-go/types"
+)
+
+func TestGeneratorRoundTrip(t *testing.T) {
+	setup()
+	users := []ID{IDParse("alice@a1"), IDParse("bob@b1")}
+	groups := []ID{IDParse("team@gteam")}
+	gen := sim.NewGenerator(users, groups)
+	// raw values, then patched ones
+	checkSamples(t, gen)
+	CompatibilityPatcherAdd(new(DefaultPatcher))
+	defer CompatibilityPatchersClear()
+	checkSamples(t, gen)
+}
+
+func checkSamples(t *testing.T, gen *sim.Generator) {
+	for _, kind := range []sim.SampleKind{sim.SampleEnvelope, sim.SampleContent, sim.SampleInstant, sim.SampleReliable} {
+		property := func(sample Mapper) bool {
+			if err := sim.CheckRoundTrip(sample); err != nil {
+				t.Log(err)
+				return false
+			}
+			return true
+		}
+		if err := quick.Check(property, &quick.Config{MaxCount: 200, Values: gen.Values(kind)}); err != nil {
+			t.Fatalf("kind %d: %v", kind, err)
+		}
+	}
+}
@@ -0,0 +1,101 @@
+/* license: https://mit-license.org
+ *
+ *  Dao-Ke-Dao: Universal Message Module
+ *
+ *                                Written in 2022 by Moky <albert.moky@gmail.com>
+ *
+ * ==============================================================================
+ * The MIT License (MIT)
+ *
+ * Copyright (c) 2022 Albert Moky
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ * ==============================================================================
+ */
+package dkd
+
+import (
+	. "github.com/dimchat/mkm-go/protocol"
+)
+
+type ReceiverClass uint8
+
+const (
+	UNICAST   ReceiverClass = 0  // normal user or group
+	ANYCAST   ReceiverClass = 1  // any one of the category, e.g.: "station@anywhere"
+	MULTICAST ReceiverClass = 2  // all of the category, e.g.: "stations@everywhere"
+)
+
+/**
+ *  Get class of the receiver:
+ *      name@anywhere  - ANYCAST
+ *      name@everywhere - MULTICAST
+ */
+func ClassifyReceiver(receiver ID) ReceiverClass {
+	if !receiver.IsBroadcast() {
+		return UNICAST
+	}
+	switch receiver.Address().String() {
+	case "anywhere":
+		return ANYCAST
+	case "everywhere":
+		return MULTICAST
+	}
+	return UNICAST
+}
+
+/**
+ *  Service Directory
+ *  ~~~~~~~~~~~~~~~~~
+ *  Finds the concrete targets for special receivers,
+ *  e.g.: all stations, or bots of a category
+ */
+type Directory interface {
+
+	/**
+	 *  Get members of the category
+	 *
+	 * @param receiver - special receiver, e.g.: "archivist@anywhere"
+	 * @return targets in preferred order; empty if not recognized
+	 */
+	Lookup(receiver ID) []ID
+}
+
+/**
+ *  Expand receiver into concrete delivery targets
+ *
+ * @param receiver  - message receiver
+ * @param directory - service directory
+ * @return the receiver itself for UNICAST (or not found in directory),
+ *         the first target for ANYCAST,
+ *         all targets for MULTICAST
+ */
+func ExpandReceiver(receiver ID, directory Directory) []ID {
+	class := ClassifyReceiver(receiver)
+	if class == UNICAST || directory == nil {
+		return []ID{receiver}
+	}
+	targets := directory.Lookup(receiver)
+	if len(targets) == 0 {
+		return []ID{receiver}
+	} else if class == ANYCAST {
+		return targets[:1]
+	}
+	return targets
+}
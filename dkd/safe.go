@@ -0,0 +1,192 @@
+/* license: https://mit-license.org
+ *
+ *  Dao-Ke-Dao: Universal Message Module
+ *
+ *                                Written in 2022 by Moky <albert.moky@gmail.com>
+ *
+ * ==============================================================================
+ * The MIT License (MIT)
+ *
+ * Copyright (c) 2022 Albert Moky
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ * ==============================================================================
+ */
+package dkd
+
+import (
+	"fmt"
+	"runtime/debug"
+	. "github.com/dimchat/dkd-go/protocol"
+	. "github.com/dimchat/mkm-go/crypto"
+	. "github.com/dimchat/mkm-go/protocol"
+)
+
+/**
+ *  Panic Error
+ *  ~~~~~~~~~~~
+ *  Panic recovered by SafeCall, with the stack where it happened
+ */
+type PanicError struct {
+	Op    string       // operation name
+	Value interface{}  // value passed to panic()
+	Stack []byte       // nil when stack capture disabled
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("%s failed: %v", e.Op, e.Value)
+}
+
+// for errors.Is/As when panic with an error, e.g.: ErrDelegateNotSet
+func (e *PanicError) Unwrap() error {
+	err, _ := e.Value.(error)
+	return err
+}
+
+var captureStack = true
+
+/**
+ *  Enable/disable stack capture for recovered panics,
+ *  capturing is expensive under a flood of malformed messages
+ */
+func SafeSetCaptureStack(flag bool) {
+	captureStack = flag
+}
+
+/**
+ *  Call function, convert panic into *PanicError
+ *
+ * @param fn - function may panic
+ * @return nil on success
+ */
+func SafeCall(fn func()) error {
+	return safeCall("call", fn)
+}
+
+func safeCall(op string, fn func()) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			e := &PanicError{Op: op, Value: r}
+			if captureStack {
+				e.Stack = debug.Stack()
+			}
+			err = e
+		}
+	}()
+	fn()
+	return nil
+}
+
+/**
+ *  Encrypt without panic
+ *
+ * @return *PolicyError with the verdict when blocked by moderation hook
+ */
+func SafeEncrypt(iMsg InstantMessage, password SymmetricKey, members []ID) (sMsg SecureMessage, err error) {
+	err = safeCall("encrypt", func() {
+		sMsg = iMsg.Encrypt(password, members)
+	})
+	if err == nil && sMsg == nil {
+		if verdict := moderationVerdict(iMsg); verdict != nil {
+			err = &PolicyError{Decision: verdict.Decision, Verdict: verdict}
+		}
+	}
+	return sMsg, err
+}
+
+/**
+ *  Decrypt without panic
+ *
+ * @return *PolicyError when rejected or quarantined by content policy
+ *         (with the verdict when blocked by moderation hook)
+ */
+func SafeDecrypt(sMsg SecureMessage) (iMsg InstantMessage, err error) {
+	err = safeCall("decrypt", func() {
+		iMsg = sMsg.Decrypt()
+	})
+	if err == nil && iMsg == nil {
+		if decision := policyDecision(sMsg); decision != ALLOW {
+			err = &PolicyError{Decision: decision, Verdict: moderationVerdict(sMsg)}
+		}
+	}
+	return iMsg, err
+}
+
+// implemented by EncryptedMessage
+type policyDecider interface {
+	PolicyDecision() Decision
+}
+
+func policyDecision(sMsg SecureMessage) Decision {
+	if decider, ok := sMsg.(policyDecider); ok {
+		return decider.PolicyDecision()
+	}
+	return ALLOW
+}
+
+// implemented by PlainMessage and EncryptedMessage
+type moderated interface {
+	ModerationVerdict() *Verdict
+}
+
+func moderationVerdict(msg Message) *Verdict {
+	if checked, ok := msg.(moderated); ok {
+		return checked.ModerationVerdict()
+	}
+	return nil
+}
+
+/**
+ *  Verify without panic
+ *
+ * @return ErrSignatureNotMatch when verify failed,
+ *         ErrRateLimited when the sender exceeds the rate limit
+ */
+func SafeVerify(rMsg ReliableMessage) (sMsg SecureMessage, err error) {
+	err = safeCall("verify", func() {
+		sMsg = rMsg.Verify()
+	})
+	if err == nil && sMsg == nil {
+		if isRateLimited(rMsg) {
+			err = ErrRateLimited
+		} else {
+			err = ErrSignatureNotMatch
+		}
+	}
+	return sMsg, err
+}
+
+/**
+ *  Parse reliable message without panic
+ *
+ * @return ErrMessageMalformed when failed to parse,
+ *         *FactoryNotSetError when factory not set
+ */
+func SafeParse(msg interface{}) (rMsg ReliableMessage, err error) {
+	var factoryErr error
+	err = safeCall("parse", func() {
+		rMsg, factoryErr = ReliableMessageParseE(msg)
+	})
+	if err == nil && factoryErr != nil {
+		err = factoryErr
+	} else if err == nil && rMsg == nil {
+		err = ErrMessageMalformed
+	}
+	return rMsg, err
+}
@@ -0,0 +1,133 @@
+/* license: https://mit-license.org
+ *
+ *  Dao-Ke-Dao: Universal Message Module
+ *
+ *                                Written in 2022 by Moky <albert.moky@gmail.com>
+ *
+ * ==============================================================================
+ * The MIT License (MIT)
+ *
+ * Copyright (c) 2022 Albert Moky
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ * ==============================================================================
+ */
+package dkd
+
+import (
+	"container/heap"
+	"sync"
+	. "github.com/dimchat/dkd-go/protocol"
+	. "github.com/dimchat/mkm-go/types"
+)
+
+/**
+ *  Message Scheduler
+ *  ~~~~~~~~~~~~~~~~~
+ *  Holds signed messages until their 'send_after' time
+ */
+type Scheduler struct {
+
+	_queue scheduleQueue
+	_lock sync.Mutex
+}
+
+func NewScheduler() *Scheduler {
+	scheduler := new(Scheduler)
+	scheduler.Init()
+	return scheduler
+}
+
+func (scheduler *Scheduler) Init() *Scheduler {
+	scheduler._queue = make(scheduleQueue, 0)
+	return scheduler
+}
+
+func (scheduler *Scheduler) Len() int {
+	scheduler._lock.Lock()
+	defer scheduler._lock.Unlock()
+	return scheduler._queue.Len()
+}
+
+/**
+ *  Hold the message until its 'send_after' time
+ *
+ * @param rMsg - signed message
+ */
+func (scheduler *Scheduler) Add(rMsg ReliableMessage) {
+	when := EnvelopeGetSendAfter(rMsg.Map())
+	var at int64
+	if !TimeIsNil(when) {
+		at = when.UnixNano()
+	}
+	scheduler._lock.Lock()
+	defer scheduler._lock.Unlock()
+	heap.Push(&scheduler._queue, &scheduledMessage{msg: rMsg, at: at})
+}
+
+/**
+ *  Release the messages which appointed time is up
+ *
+ * @param now - current time
+ * @return messages to send, ordered by appointed time
+ */
+func (scheduler *Scheduler) Due(now Time) []ReliableMessage {
+	deadline := now.UnixNano()
+	messages := make([]ReliableMessage, 0)
+	scheduler._lock.Lock()
+	defer scheduler._lock.Unlock()
+	for scheduler._queue.Len() > 0 && scheduler._queue[0].at <= deadline {
+		item := heap.Pop(&scheduler._queue).(*scheduledMessage)
+		messages = append(messages, item.msg)
+	}
+	return messages
+}
+
+type scheduledMessage struct {
+	msg ReliableMessage
+	at  int64  // nanoseconds
+}
+
+// min-heap by appointed time
+type scheduleQueue []*scheduledMessage
+
+func (queue scheduleQueue) Len() int {
+	return len(queue)
+}
+
+func (queue scheduleQueue) Less(i, j int) bool {
+	return queue[i].at < queue[j].at
+}
+
+func (queue scheduleQueue) Swap(i, j int) {
+	queue[i], queue[j] = queue[j], queue[i]
+}
+
+func (queue *scheduleQueue) Push(x interface{}) {
+	*queue = append(*queue, x.(*scheduledMessage))
+}
+
+func (queue *scheduleQueue) Pop() interface{} {
+	old := *queue
+	n := len(old)
+	item := old[n-1]
+	old[n-1] = nil
+	*queue = old[:n-1]
+	return item
+}
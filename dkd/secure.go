@@ -31,7 +31,9 @@
 package dkd
 
 import (
+	"context"
 	. "github.com/dimchat/dkd-go/protocol"
+	. "github.com/dimchat/mkm-go/crypto"
 	. "github.com/dimchat/mkm-go/protocol"
 	. "github.com/dimchat/mkm-go/types"
 )
@@ -60,11 +62,20 @@ type EncryptedMessage struct {
 	_data []byte
 	_key []byte
 	_keys map[string]string
+
+	// '_data'/'_key' are borrowed from buffer pool
+	_pooled bool
+	_keyPooled bool
+
+	// policy decision of the last decryption
+	_decision Decision
+	_verdict *Verdict
 }
 
 func NewSecureMessage(dict map[string]interface{}) SecureMessage {
 	msg := new(EncryptedMessage)
 	msg.Init(dict)
+	trackSecrets(msg)
 	return msg
 }
 
@@ -74,6 +85,8 @@ func (msg *EncryptedMessage) Init(dict map[string]interface{}) SecureMessage {
 		msg._data = nil
 		msg._key = nil
 		msg._keys = nil
+		msg._pooled = false
+		msg._keyPooled = false
 	}
 	return msg
 }
@@ -83,7 +96,13 @@ func (msg *EncryptedMessage) Init(dict map[string]interface{}) SecureMessage {
 func (msg *EncryptedMessage) EncryptedData() []byte {
 	if msg._data == nil {
 		base64 := msg.Get("data")
-		msg._data = msg.Delegate().DecodeData(base64, msg)
+		delegate := msg.RequireDelegate()
+		if decoder, ok := bufferedDataDecoder(delegate); ok {
+			msg._data = decoder.DecodeDataInto(borrowBuffer(), base64, msg)
+			msg._pooled = msg._data != nil
+		} else {
+			msg._data = delegate.DecodeData(base64, msg)
+		}
 	}
 	return msg._data
 }
@@ -99,8 +118,13 @@ func (msg *EncryptedMessage) EncryptedKey() []byte {
 				base64 = keys[receiver.String()]
 			}
 		}
-		if base64 != nil {
-			msg._key = msg.Delegate().DecodeKey(base64, msg)
+		if base64 == nil {
+			// no key
+		} else if decoder, ok := bufferedDataDecoder(msg.RequireDelegate()); ok {
+			msg._key = decoder.DecodeKeyInto(borrowBuffer(), base64, msg)
+			msg._keyPooled = msg._key != nil
+		} else {
+			msg._key = msg.RequireDelegate().DecodeKey(base64, msg)
 		}
 	}
 	return msg._key
@@ -108,14 +132,64 @@ func (msg *EncryptedMessage) EncryptedKey() []byte {
 
 func (msg *EncryptedMessage) EncryptedKeys() map[string]string {
 	if msg._keys == nil {
-		keys := msg.Get("keys")
-		if keys != nil {
-			msg._keys, _ = keys.(map[string]string)
+		switch keys := msg.Get("keys").(type) {
+		case map[string]string:
+			msg._keys = keys
+		case map[string]interface{}:
+			// decoded from JsON
+			msg._keys = make(map[string]string, len(keys))
+			for member, base64 := range keys {
+				msg._keys[member], _ = base64.(string)
+			}
 		}
 	}
 	return msg._keys
 }
 
+func (msg *EncryptedMessage) Wipe() {
+	wipeBytes(msg._data)
+	wipeBytes(msg._key)
+	msg.resetData()
+	msg.resetKey()
+}
+
+func (msg *EncryptedMessage) hasSecrets() bool {
+	return msg._data != nil || msg._key != nil
+}
+
+// drop decoded 'data', it will be reloaded from the map
+func (msg *EncryptedMessage) resetData() {
+	if msg._pooled {
+		returnBuffer(msg._data)
+		msg._pooled = false
+	}
+	msg._data = nil
+}
+
+// drop decoded 'key', it will be reloaded from the map
+func (msg *EncryptedMessage) resetKey() {
+	if msg._keyPooled {
+		returnBuffer(msg._key)
+		msg._keyPooled = false
+	}
+	msg._key = nil
+}
+
+// return the pooled buffers after transform finished,
+// the decoded fields not from pool are kept
+func (msg *EncryptedMessage) releaseBuffers() {
+	if msg._pooled {
+		msg.resetData()
+	}
+	if msg._keyPooled {
+		msg.resetKey()
+	}
+}
+
+func (msg *EncryptedMessage) KeyDigest() string {
+	return SecureMessageGetKeyDigest(msg.Map())
+}
+
 /*
  *  Decrypt the Secure Message to Instant Message
  *
@@ -135,66 +209,246 @@ func (msg *EncryptedMessage) EncryptedKeys() map[string]string {
  * @return InstantMessage object
  */
 func (msg *EncryptedMessage) Decrypt() InstantMessage {
+	return msg.DecryptInto(nil)
+}
+
+/**
+ *  Decrypt message into the given map, which will be cleared first;
+ *  the source message is never modified
+ *
+ * @param dst - map to hold the instant message; nil to create a new one
+ * @return InstantMessage object
+ */
+func (msg *EncryptedMessage) DecryptInto(dst map[string]interface{}) InstantMessage {
+	return msg.decrypt(context.Background(), dst)
+}
+
+func (msg *EncryptedMessage) DecryptContext(ctx context.Context) InstantMessage {
+	return msg.decrypt(ctx, nil)
+}
+
+func (msg *EncryptedMessage) decrypt(ctx context.Context, dst map[string]interface{}) InstantMessage {
 	var sender = msg.Sender()
-	var receiver ID
-	var group = msg.Group()
-	if group == nil {
-		// personal message
-		// not split group message
-		receiver = msg.Receiver()
-	} else {
-		// group message
-		receiver = group
+	// group ID for group message, or receiver for personal message
+	var receiver = ExpandedReceiver(msg)
+	// decoded buffers are only needed while decrypting
+	defer msg.releaseBuffers()
+
+	if SecureMessageIsPlaintext(msg.Map()) {
+		return msg.decode(dst)
 	}
 
-	// 1. decrypt 'message.key' to symmetric key
-	delegate := msg.Delegate()
-	// 1.1. decode encrypted key data
-	key := msg.EncryptedKey()
-	// 1.2. decrypt key data
-	if key != nil {
-		key = delegate.DecryptKey(key, sender, receiver, msg)
-		if key == nil {
-			panic("failed to decrypt key in msg")
+	delegate := msg.RequireDelegate()
+	var password SymmetricKey
+	ratchet := MessageGetRatchetHeader(msg.Map())
+	sessions := sessionKeys(delegate)
+	if ratchet != nil && sessions != nil {
+		// 1. get message key from ratchet session
+		password = sessions.Lookup(sender, receiver, ratchet)
+		if password == nil {
+			panic("failed to get ratchet message key")
 		}
-	}
-	// 1.3. deserialize key
-	//      if key is empty, means it should be reused, get it from key cache
-	password := delegate.DeserializeKey(key, sender, receiver, msg)
-	if password == nil {
-		panic("failed to get msg key")
+	} else {
+		// 1. decrypt 'message.key' to symmetric key
+		password = msg.decryptKey(ctx, delegate, sender, receiver)
 	}
 
 	// 2. decrypt 'message.data' to 'message.content'
 	// 2.1. decode encrypted content data
-	data := msg.EncryptedData()
-	if data == nil {
+	encrypted := msg.EncryptedData()
+	if encrypted == nil {
 		panic("failed to decode content data")
 	}
 	// 2.2. decrypt content data
-	data = delegate.DecryptContent(data, password, msg)
+	var data []byte
+	if aad := SecureMessageGetAAD(msg.Map()); aad > 0 {
+		sealer, ok := aadDelegate(delegate)
+		if !ok {
+			panic("AAD not supported")
+		}
+		data = sealer.DecryptContentWithAAD(encrypted, MessageBuildAAD(msg.Map(), aad), password, msg)
+	} else {
+		data = delegate.DecryptContent(encrypted, password, msg)
+	}
 	if data == nil {
 		panic("failed to decrypt data with key")
 	}
+	// plaintext is not needed after deserialized
+	defer wipeDecrypted(data, encrypted)
+	if SecureMessageIsPadded(msg.Map()) {
+		data = UnpadData(data)
+		if data == nil {
+			panic("failed to remove padding")
+		}
+	}
 	// 2.3. deserialize content
 	content := delegate.DeserializeContent(data, password, msg)
 	if content == nil {
 		panic("failed to deserialize content")
 	}
+	if ratchet != nil && sessions != nil {
+		// message key used, move the session forward
+		sessions.Commit(sender, receiver, ratchet)
+	}
 	// 2.4. check attachment for File/Image/Audio/Video message content
 	//      if file data not download yet,
 	//          decrypt file data with password;
 	//      else,
 	//          save password to 'message.content.password'.
 	//      (do it in 'core' module)
+	// 2.5. check content policy
+	if msg._decision = msg.check(content); msg._decision != ALLOW {
+		// rejected or quarantined
+		return nil
+	}
 
 	// 3. pack message
-	info := msg.CopyMap(false)
-	delete(info, "key")
-	delete(info, "keys")
-	delete(info, "data")
+	info := msg.copyInto(dst, "key", "keys", "data", "padded", "cipher", "aad")
+	info["content"] = content.Map()
+	return msg.packInstant(info)
+}
+
+func (msg *EncryptedMessage) decryptKey(ctx context.Context, delegate MessageDelegate, sender ID, receiver ID) SymmetricKey {
+	// 1.1. decode encrypted key data
+	encrypted := msg.EncryptedKey()
+	key := encrypted
+	// 1.2. decrypt key data
+	if key != nil {
+		if async, ok := asyncDelegate(delegate); ok {
+			key = await(ctx, async.DecryptKeyAsync(ctx, key, sender, receiver, msg))
+		} else {
+			key = delegate.DecryptKey(key, sender, receiver, msg)
+		}
+		if key == nil {
+			panic("failed to decrypt key in msg")
+		}
+	}
+	if key != nil {
+		// serialized key is not needed after deserialized
+		defer wipeDecrypted(key, encrypted)
+	}
+	// 1.3. deserialize key
+	//      if key is empty, means it should be reused, get it from key cache
+	password := delegate.DeserializeKey(key, sender, receiver, msg)
+	if password == nil {
+		digest := msg.KeyDigest()
+		if requester, ok := keyDigestDelegate(delegate); ok && key == nil && digest != "" {
+			// reused key not found in cache, ask the sender for it
+			requester.RequestKey(digest, msg)
+		}
+		panic("failed to get msg key")
+	}
+	return password
+}
+
+/**
+ *  Get the policy decision of the last decryption,
+ *  when Decrypt() returns nil without panic
+ *
+ * @return REJECT or QUARANTINE when not delivered
+ */
+func (msg *EncryptedMessage) PolicyDecision() Decision {
+	return msg._decision
+}
+
+/**
+ *  Get the moderation verdict of the last decryption
+ *
+ * @return nil when not blocked by moderation hook
+ */
+func (msg *EncryptedMessage) ModerationVerdict() *Verdict {
+	return msg._verdict
+}
+
+func (msg *EncryptedMessage) check(content Content) Decision {
+	msg._verdict = nil
+	policy := ContentPolicyGet()
+	if policy != nil {
+		if decision := policy.Allow(content, msg.Envelope()); decision != ALLOW {
+			return decision
+		}
+	}
+	verdict := ContentModerateVerdict(content, msg.Envelope(), false)
+	if verdict == nil || verdict.Decision == ALLOW {
+		return ALLOW
+	}
+	msg._verdict = verdict
+	return verdict.Decision
+}
+
+// decode plaintext message
+func (msg *EncryptedMessage) decode(dst map[string]interface{}) InstantMessage {
+	data := msg.EncryptedData()
+	if data == nil {
+		panic("failed to decode content data")
+	}
+	content := msg.RequireDelegate().DeserializeContent(data, nil, msg)
+	if content == nil {
+		panic("failed to deserialize content")
+	}
+	if msg._decision = msg.check(content); msg._decision != ALLOW {
+		// rejected or quarantined
+		return nil
+	}
+	// pack message, keep 'plaintext' so the receiver knows it was not encrypted
+	info := msg.copyInto(dst, "data")
 	info["content"] = content.Map()
-	return InstantMessageParse(info)
+	return msg.packInstant(info)
+}
+
+// 'data' to be signed, with AAD if flagged (or the ratchet header)
+func signedData(msg SecureMessage) []byte {
+	data := msg.EncryptedData()
+	if data == nil {
+		return nil
+	}
+	var extra []byte
+	if aad := SecureMessageGetAAD(msg.Map()); aad > 0 {
+		extra = MessageBuildAAD(msg.Map(), aad)
+	} else {
+		extra = MessageRatchetAAD(msg.Map())
+	}
+	if len(extra) > 0 {
+		signed := make([]byte, 0, len(data) + len(extra))
+		data = append(append(signed, data...), extra...)
+	}
+	return data
+}
+
+// wait for async delegate, panic when ctx done first
+func await(ctx context.Context, result <-chan []byte) []byte {
+	select {
+	case data := <-result:
+		return data
+	case <-ctx.Done():
+		panic(ctx.Err())
+	}
+}
+
+// shallow copy the message fields into 'dst', except the excluded keys
+func (msg *EncryptedMessage) copyInto(dst map[string]interface{}, excludes ...string) map[string]interface{} {
+	if dst == nil {
+		dst = make(map[string]interface{})
+	} else {
+		for key := range dst {
+			delete(dst, key)
+		}
+	}
+	for key, value := range msg.Map() {
+		dst[key] = value
+	}
+	for _, key := range excludes {
+		delete(dst, key)
+	}
+	return dst
+}
+
+func (msg *EncryptedMessage) packInstant(info map[string]interface{}) InstantMessage {
+	iMsg := InstantMessageParse(info)
+	if iMsg != nil {
+		msg.propagateDelegate(iMsg)
+	}
+	return iMsg
 }
 
 /*
@@ -217,17 +471,38 @@ func (msg *EncryptedMessage) Decrypt() InstantMessage {
  * @return ReliableMessage object
  */
 func (msg *EncryptedMessage) Sign() ReliableMessage {
-	delegate := msg.Delegate()
+	return msg.SignContext(context.Background())
+}
+
+func (msg *EncryptedMessage) SignContext(ctx context.Context) ReliableMessage {
+	delegate := msg.RequireDelegate()
 	sender := msg.Sender()
-	data := msg.EncryptedData()
+	data := signedData(msg)
 	// 1. sign with sender's private key
-	signature := delegate.SignData(data, sender, msg)
+	var signature []byte
+	if async, ok := asyncDelegate(delegate); ok {
+		signature = await(ctx, async.SignDataAsync(ctx, data, sender, msg))
+		if signature == nil {
+			panic("failed to sign message data")
+		}
+	} else {
+		signature = delegate.SignData(data, sender, msg)
+	}
 	// 2. encode signature
 	base64 := delegate.EncodeSignature(signature, msg)
 	// 3. pack message
 	info := msg.CopyMap(false)
 	info["signature"] = base64
-	return ReliableMessageParse(info)
+	rMsg := ReliableMessageParse(info)
+	if rMsg != nil {
+		msg.propagateDelegate(rMsg)
+	}
+	// 4. attach meta/visa for handshake
+	policy := AttachmentPolicyGet()
+	if policy != nil && rMsg != nil {
+		policy.Attach(rMsg)
+	}
+	return rMsg
 }
 
 /*
@@ -243,6 +518,21 @@ func (msg *EncryptedMessage) Sign() ReliableMessage {
  *  @return secure/reliable message(s)
  */
 func (msg *EncryptedMessage) Split(members []ID) []SecureMessage {
+	return msg.SplitWithKeyProvider(members, nil)
+}
+
+func (msg *EncryptedMessage) SplitWithKeyProvider(members []ID, provider KeyProvider) []SecureMessage {
+	return msg.SplitWithOptions(members, &SplitOptions{
+		IncludeTraces: true,
+		KeyProvider: provider,
+	})
+}
+
+func (msg *EncryptedMessage) SplitWithOptions(members []ID, options *SplitOptions) []SecureMessage {
+	if options == nil {
+		// same as Split()
+		options = &SplitOptions{IncludeTraces: true}
+	}
 	info := msg.CopyMap(false)
 	// check 'keys'
 	keys := msg.EncryptedKeys()
@@ -256,15 +546,29 @@ func (msg *EncryptedMessage) Split(members []ID) []SecureMessage {
 	//    this will help the receiver knows the group ID
 	//    when the group message separated to multi-messages;
 	//    if don't want the others know your membership,
-	//    DON'T do this.
-	info["group"] = msg.Receiver()
+	//    set 'HideGroup' in options.
+	//    (a personal message with carbon copies has no group to keep)
+	if options.HideGroup && SecureMessageGetAAD(msg.Map()) > 0 {
+		// AAD binds the group ID, members could not decrypt without it
+		panic(ErrHideGroupWithAAD)
+	}
+	if !options.HideGroup && EnvelopeGetReceivers(msg.Map()) == nil {
+		info["group"] = ExpandedReceiver(msg).String()
+	}
+	if !options.IncludeTraces {
+		delete(info, "traces")
+	}
+	provider := options.KeyProvider
 
 	messages := make([]SecureMessage, 0, len(members))
 	for _, member := range members {
 		// 2. change 'receiver' to each group member
-		info["receiver"] = member
+		info["receiver"] = member.String()
 		// 3. get encrypted key
 		base64 := keys[member.String()]
+		if base64 == "" && provider != nil {
+			base64 = provider.ProvideKey(member, msg)
+		}
 		if base64 == "" {
 			delete(info, "key")
 		} else {
@@ -273,6 +577,7 @@ func (msg *EncryptedMessage) Split(members []ID) []SecureMessage {
 		// 4. repack message
 		sMsg := SecureMessageParse(CopyMap(info))
 		if sMsg != nil {
+			msg.propagateDelegate(sMsg)
 			messages = append(messages, sMsg)
 		}
 	}
@@ -297,15 +602,49 @@ func (msg *EncryptedMessage) Trim(member ID) SecureMessage {
 		}
 		delete(info, "keys")
 	}
+	return msg.trimReceiver(info, member)
+}
+
+func (msg *EncryptedMessage) TrimE(member ID) (SecureMessage, error) {
+	return msg.trimStrict(member, false)
+}
+
+func (msg *EncryptedMessage) TrimWithSharedKey(member ID) (SecureMessage, error) {
+	return msg.trimStrict(member, true)
+}
+
+func (msg *EncryptedMessage) trimStrict(member ID, fallback bool) (SecureMessage, error) {
+	info := msg.CopyMap(false)
+	// check 'keys'
+	keys := msg.EncryptedKeys()
+	if keys != nil {
+		base64 := keys[member.String()]
+		if base64 != "" {
+			// move key data from 'keys' to key
+			info["key"] = base64
+		} else if !fallback || info["key"] == nil {
+			// member not in 'keys', and no group-shared 'key' to use
+			return nil, ErrMemberKeyNotFound
+		}
+		delete(info, "keys")
+	}
+	return msg.trimReceiver(info, member), nil
+}
+
+func (msg *EncryptedMessage) trimReceiver(info map[string]interface{}, member ID) SecureMessage {
 	// check 'group'
-	group := msg.Group()
-	if group == nil {
+	if !IsSplitGroupMessage(msg) && EnvelopeGetReceivers(msg.Map()) == nil {
 		// if 'group' not exists, the 'receiver' must be a group ID here, and
 		// it will not be equal to the member of course,
-		// so move 'receiver' to 'group'
-		info["group"] = msg.Receiver()
+		// so move 'receiver' to 'group';
+		// (a personal message with carbon copies has no group to keep)
+		info["group"] = msg.Receiver().String()
 	}
-	info["receiver"] = member
+	info["receiver"] = member.String()
 	// repack
-	return SecureMessageParse(info)
+	sMsg := SecureMessageParse(info)
+	if sMsg != nil {
+		msg.propagateDelegate(sMsg)
+	}
+	return sMsg
 }
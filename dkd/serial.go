@@ -0,0 +1,100 @@
+/* license: https://mit-license.org
+ *
+ *  Dao-Ke-Dao: Universal Message Module
+ *
+ *                                Written in 2022 by Moky <albert.moky@gmail.com>
+ *
+ * ==============================================================================
+ * The MIT License (MIT)
+ *
+ * Copyright (c) 2022 Albert Moky
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ * ==============================================================================
+ */
+package dkd
+
+import (
+	"sync"
+	. "github.com/dimchat/mkm-go/protocol"
+)
+
+/**
+ *  Serial Number Store
+ *  ~~~~~~~~~~~~~~~~~~~
+ *  Persistence for the last serial number in each chat box
+ */
+type SerialNumberStore interface {
+
+	// return 0 when not found
+	LoadSerialNumber(sender ID, conversation ID) uint64
+
+	SaveSerialNumber(sender ID, conversation ID, sn uint64)
+}
+
+/**
+ *  Serial Number Allocator
+ *  ~~~~~~~~~~~~~~~~~~~~~~~
+ *  Allocates increasing serial numbers for each (sender, conversation),
+ *  falls back to random numbers when no store configured.
+ */
+type SNAllocator struct {
+
+	_store SerialNumberStore
+
+	_last map[string]uint64
+	_lock sync.Mutex
+}
+
+func NewSNAllocator(store SerialNumberStore) *SNAllocator {
+	allocator := new(SNAllocator)
+	allocator.Init(store)
+	return allocator
+}
+
+func (allocator *SNAllocator) Init(store SerialNumberStore) *SNAllocator {
+	allocator._store = store
+	allocator._last = make(map[string]uint64)
+	return allocator
+}
+
+/**
+ *  Allocate next serial number in the chat box
+ *
+ * @param sender       - message sender
+ * @param conversation - receiver or group ID
+ * @return serial number
+ */
+func (allocator *SNAllocator) Next(sender ID, conversation ID) uint64 {
+	store := allocator._store
+	if store == nil {
+		return randomSerialNumber()
+	}
+	key := sender.String() + "|" + conversation.String()
+	allocator._lock.Lock()
+	defer allocator._lock.Unlock()
+	last, ok := allocator._last[key]
+	if !ok {
+		last = store.LoadSerialNumber(sender, conversation)
+	}
+	sn := last + 1
+	allocator._last[key] = sn
+	store.SaveSerialNumber(sender, conversation, sn)
+	return sn
+}
@@ -0,0 +1,108 @@
+/* license: https://mit-license.org
+ *
+ *  Dao-Ke-Dao: Universal Message Module
+ *
+ *                                Written in 2022 by Moky <albert.moky@gmail.com>
+ *
+ * ==============================================================================
+ * The MIT License (MIT)
+ *
+ * Copyright (c) 2022 Albert Moky
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ * ==============================================================================
+ */
+package dkd_test
+
+import (
+	"testing"
+	"github.com/dimchat/dkd-go/dkd/sim"
+	. "github.com/dimchat/dkd-go/dkd"
+	. "github.com/dimchat/dkd-go/protocol"
+	. "github.com/dimchat/mkm-go/crypto"
+	. "github.com/dimchat/mkm-go/protocol"
+	. "github.com/dimchat/mkm-go/types"
+)
+
+type testSessions struct {
+	key SymmetricKey
+	commits int
+}
+
+func (sessions *testSessions) Advance(_ ID, _ ID) (SymmetricKey, *RatchetHeader) {
+	return sessions.key, &RatchetHeader{Ratchet: "AAAA", ChainIndex: uint64(sessions.commits)}
+}
+
+func (sessions *testSessions) Lookup(_ ID, _ ID, header *RatchetHeader) SymmetricKey {
+	if header.Ratchet != "AAAA" {
+		return nil
+	}
+	return sessions.key
+}
+
+func (sessions *testSessions) Commit(_ ID, _ ID, _ *RatchetHeader) {
+	sessions.commits++
+}
+
+type sessionPeer struct {
+	*sim.Peer
+	sessions *testSessions
+}
+
+func (peer *sessionPeer) SessionKeys() SessionKeyProvider {
+	return peer.sessions
+}
+
+func TestRatchetSession(t *testing.T) {
+	sessions := &testSessions{key: new(testCrypto).GenerateKey()}
+	alice, bob := &sessionPeer{newPeer("alice@a1"), sessions}, &sessionPeer{newPeer("bob@b1"), sessions}
+	env := EnvelopeCreate(alice.ID(), bob.ID(), TimeNow())
+	iMsg := NewInstantMessage(nil, env, textContent("hello"))
+	iMsg.SetDelegate(alice)
+
+	sMsg := iMsg.Encrypt(new(testCrypto).GenerateKey(), nil)
+	if sMsg == nil || sMsg.Get("key") != nil || sMsg.Get("ratchet") != "AAAA" {
+		t.Fatalf("unexpected ratchet message: %v", sMsg)
+	}
+	sMsg.SetDelegate(bob)
+	decrypted := sMsg.Decrypt()
+	if decrypted == nil || decrypted.Content().Get("text") != "hello" {
+		t.Fatal("failed to decrypt ratchet message")
+	}
+	if sessions.commits != 2 {
+		t.Fatalf("expected 2 commits, got %d", sessions.commits)
+	}
+}
+
+func TestRatchetHeaderSigned(t *testing.T) {
+	sessions := &testSessions{key: new(testCrypto).GenerateKey()}
+	alice, bob := &sessionPeer{newPeer("alice@a1"), sessions}, &sessionPeer{newPeer("bob@b1"), sessions}
+	env := EnvelopeCreate(alice.ID(), bob.ID(), TimeNow())
+	iMsg := NewInstantMessage(nil, env, textContent("hello"))
+	iMsg.SetDelegate(alice)
+	info := iMsg.Encrypt(new(testCrypto).GenerateKey(), nil).Sign().CopyMap(false)
+
+	// relay rewrites the chain index
+	info["chain_idx"] = 12345
+	rMsg := ReliableMessageParse(info)
+	rMsg.SetDelegate(bob)
+	if sMsg := rMsg.Verify(); sMsg != nil {
+		t.Fatal("tampered ratchet header verified")
+	}
+}
@@ -0,0 +1,368 @@
+/* license: https://mit-license.org
+ *
+ *  Dao-Ke-Dao: Universal Message Module
+ *
+ *                                Written in 2022 by Moky <albert.moky@gmail.com>
+ *
+ * ==============================================================================
+ * The MIT License (MIT)
+ *
+ * Copyright (c) 2022 Albert Moky
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ * ==============================================================================
+ */
+package sim
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"reflect"
+	"sort"
+	"strconv"
+	. "github.com/dimchat/dkd-go/dkd"
+	. "github.com/dimchat/dkd-go/protocol"
+	. "github.com/dimchat/mkm-go/format"
+	. "github.com/dimchat/mkm-go/protocol"
+	. "github.com/dimchat/mkm-go/types"
+)
+
+type SampleKind uint8
+
+const (
+	SampleEnvelope SampleKind = iota
+	SampleContent
+	SampleInstant
+	SampleReliable
+)
+
+/**
+ *  Random Message Generator
+ *  ~~~~~~~~~~~~~~~~~~~~~~~~
+ *  Produces random envelopes/contents/messages for property-based tests:
+ *
+ *      gen := sim.NewGenerator(users, groups)
+ *      quick.Check(func(rMsg ReliableMessage) bool {
+ *          return sim.CheckRoundTrip(rMsg) == nil
+ *      }, &quick.Config{Values: gen.Values(sim.SampleReliable)})
+ *
+ *  Values cover the raw forms sent by old clients: 'sn' in the full uint64
+ *  range (sometimes as string), 'time' in seconds or milliseconds; samples
+ *  are parsed, so they are patched by the installed compatibility patchers.
+ *  IDs are picked from the pools, parsed by the installed ID factory.
+ */
+type Generator struct {
+
+	_users []ID
+	_groups []ID
+}
+
+func NewGenerator(users []ID, groups []ID) *Generator {
+	gen := new(Generator)
+	gen.Init(users, groups)
+	return gen
+}
+
+func (gen *Generator) Init(users []ID, groups []ID) *Generator {
+	gen._users = users
+	gen._groups = groups
+	return gen
+}
+
+/**
+ *  Get value generator for testing/quick
+ *
+ * @param kinds - sample kind for each argument of the property function
+ * @return function for quick.Config.Values
+ */
+func (gen *Generator) Values(kinds ...SampleKind) func([]reflect.Value, *rand.Rand) {
+	return func(args []reflect.Value, r *rand.Rand) {
+		for index := range args {
+			kind := SampleReliable
+			if index < len(kinds) {
+				kind = kinds[index]
+			}
+			args[index] = reflect.ValueOf(gen.Sample(kind, r, 8))
+		}
+	}
+}
+
+func (gen *Generator) Sample(kind SampleKind, r *rand.Rand, size int) Mapper {
+	switch kind {
+	case SampleEnvelope:
+		return gen.Envelope(r, size)
+	case SampleContent:
+		return gen.Content(r, size)
+	case SampleInstant:
+		return gen.InstantMessage(r, size)
+	}
+	return gen.ReliableMessage(r, size)
+}
+
+func (gen *Generator) Envelope(r *rand.Rand, size int) Envelope {
+	return EnvelopeParse(gen.envelope(r, nil))
+}
+
+func (gen *Generator) Content(r *rand.Rand, size int) Content {
+	return ContentParse(gen.content(r, size, nil))
+}
+
+func (gen *Generator) InstantMessage(r *rand.Rand, size int) InstantMessage {
+	var group ID
+	if len(gen._groups) > 0 && r.Intn(2) == 0 {
+		group = gen._groups[r.Intn(len(gen._groups))]
+	}
+	info := gen.envelope(r, group)
+	info["content"] = gen.content(r, size, group)
+	return InstantMessageParse(info)
+}
+
+func (gen *Generator) ReliableMessage(r *rand.Rand, size int) ReliableMessage {
+	info := gen.envelope(r, nil)
+	info["data"] = Base64Encode(randomBytes(r, 16 + r.Intn(16 * (size + 1))))
+	info["signature"] = Base64Encode(randomBytes(r, 64))
+	if receiver := EnvelopeGetReceiver(info); receiver != nil && receiver.IsGroup() {
+		keys := make(map[string]interface{}, len(gen._users))
+		for _, member := range gen._users {
+			keys[member.String()] = Base64Encode(randomBytes(r, 32))
+		}
+		info["keys"] = keys
+	} else {
+		info["key"] = Base64Encode(randomBytes(r, 32))
+	}
+	return ReliableMessageParse(info)
+}
+
+func (gen *Generator) envelope(r *rand.Rand, group ID) map[string]interface{} {
+	info := map[string]interface{}{
+		"sender": gen.user(r).String(),
+		"time": randomTime(r),
+	}
+	if group != nil {
+		info["receiver"] = group.String()
+	} else if len(gen._groups) > 0 && r.Intn(3) == 0 {
+		info["receiver"] = gen._groups[r.Intn(len(gen._groups))].String()
+	} else {
+		info["receiver"] = gen.user(r).String()
+	}
+	if r.Intn(2) == 0 {
+		info["type"] = int(randomType(r))
+	}
+	if group != nil && r.Intn(2) == 0 {
+		// split group message
+		info["receiver"] = gen.user(r).String()
+		info["group"] = group.String()
+	}
+	return info
+}
+
+func (gen *Generator) content(r *rand.Rand, size int, group ID) map[string]interface{} {
+	info := map[string]interface{}{
+		"type": int(randomType(r)),
+		"sn": randomSN(r),
+		"time": randomTime(r),
+	}
+	if group != nil {
+		info["group"] = group.String()
+	}
+	if r.Intn(2) == 0 {
+		info["text"] = randomString(r, size * 4)
+	}
+	for index := r.Intn(size + 1); index > 0; index-- {
+		info[fmt.Sprintf("x_%d", index)] = randomValue(r, size / 2)
+	}
+	return info
+}
+
+func (gen *Generator) user(r *rand.Rand) ID {
+	return gen._users[r.Intn(len(gen._users))]
+}
+
+func randomType(r *rand.Rand) ContentType {
+	aliases := ContentTypeAliases()
+	types := make([]int, 0, len(aliases))
+	for msgType := range aliases {
+		types = append(types, int(msgType))
+	}
+	if len(types) == 0 {
+		return TEXT
+	}
+	// map order is random, pick with the seeded source
+	sort.Ints(types)
+	return ContentType(types[r.Intn(len(types))])
+}
+
+// full uint64 range, sometimes as string
+func randomSN(r *rand.Rand) interface{} {
+	sn := r.Uint64()
+	if sn == 0 {
+		sn = 1
+	}
+	if r.Intn(4) == 0 {
+		return strconv.FormatUint(sn, 10)
+	}
+	return sn
+}
+
+// seconds with milliseconds, sometimes in milliseconds
+func randomTime(r *rand.Rand) interface{} {
+	millis := (1500000000 + r.Int63n(500000000)) * 1000 + r.Int63n(1000)
+	if r.Intn(4) == 0 {
+		return millis
+	}
+	return float64(millis) / 1000
+}
+
+func randomBytes(r *rand.Rand, size int) []byte {
+	data := make([]byte, size)
+	r.Read(data)
+	return data
+}
+
+// including escaped & multi-byte chars
+var stringAlphabet = []rune("abcXYZ019 _-\"\\/<>&\n\t中文€😀")
+
+func randomString(r *rand.Rand, size int) string {
+	text := make([]rune, r.Intn(size + 1))
+	for index := range text {
+		text[index] = stringAlphabet[r.Intn(len(stringAlphabet))]
+	}
+	return string(text)
+}
+
+func randomValue(r *rand.Rand, depth int) interface{} {
+	choice := r.Intn(7)
+	if depth <= 0 {
+		choice = r.Intn(5)
+	}
+	switch choice {
+	case 0:
+		return randomString(r, 16)
+	case 1:
+		// integers within the precise range of float64
+		return r.Int63n(1 << 53) - (1 << 52)
+	case 2:
+		return r.NormFloat64()
+	case 3:
+		return r.Intn(2) == 0
+	case 4:
+		return nil
+	case 5:
+		array := make([]interface{}, r.Intn(4))
+		for index := range array {
+			array[index] = randomValue(r, depth - 1)
+		}
+		return array
+	}
+	dict := make(map[string]interface{})
+	for index := r.Intn(4); index > 0; index-- {
+		dict[randomString(r, 8)] = randomValue(r, depth - 1)
+	}
+	return dict
+}
+
+/**
+ *  Check parse(serialize(x)) == x with all codecs:
+ *
+ *      "json"   - encoding/json, numbers as float64 (compared with the
+ *                 float64 decoded value, as 'sn' above 2^53 is lossy)
+ *      "number" - JSONDecodeNumbers, numbers as json.Number
+ *      "frame"  - hybrid frame (reliable message only)
+ *
+ *  both sides compared in canonical JsON
+ *
+ * @param sample - envelope, content or message
+ * @return error describing the first mismatch
+ */
+func CheckRoundTrip(sample Mapper) error {
+	expected, err := CanonicalJSON(sample.Map())
+	if err != nil {
+		return err
+	}
+	// 1. encoding/json
+	var info map[string]interface{}
+	if err = json.Unmarshal(expected, &info); err != nil {
+		return err
+	}
+	lossy, err := CanonicalJSON(info)
+	if err != nil {
+		return err
+	}
+	if err = compareParsed("json", lossy, parseSample(sample, info)); err != nil {
+		return err
+	}
+	// 2. json.Number
+	object, err := JSONDecodeNumbers(string(expected))
+	if err != nil {
+		return err
+	}
+	info, _ = object.(map[string]interface{})
+	if err = compareParsed("number", expected, parseSample(sample, info)); err != nil {
+		return err
+	}
+	// 3. hybrid frame
+	if rMsg, ok := sample.(ReliableMessage); ok {
+		frame, err := EncodeHybridFrame(rMsg)
+		if err != nil {
+			return fmt.Errorf("frame: %v", err)
+		}
+		parsed, err := DecodeHybridFrame(frame, Limits{})
+		if err != nil {
+			return fmt.Errorf("frame: %v", err)
+		}
+		return compareParsed("frame", expected, parsed)
+	}
+	return nil
+}
+
+func parseSample(sample Mapper, info map[string]interface{}) Mapper {
+	var parsed Mapper
+	switch sample.(type) {
+	case ReliableMessage:
+		parsed = ReliableMessageParse(info)
+	case SecureMessage:
+		parsed = SecureMessageParse(info)
+	case InstantMessage:
+		parsed = InstantMessageParse(info)
+	case Content:
+		parsed = ContentParse(info)
+	case Envelope:
+		parsed = EnvelopeParse(info)
+	}
+	if ValueIsNil(parsed) {
+		return nil
+	}
+	return parsed
+}
+
+func compareParsed(codec string, expected []byte, parsed Mapper) error {
+	if parsed == nil {
+		return fmt.Errorf("%s: failed to parse %s", codec, expected)
+	}
+	got, err := CanonicalJSON(parsed.Map())
+	if err != nil {
+		return fmt.Errorf("%s: %v", codec, err)
+	}
+	if !bytes.Equal(got, expected) {
+		return fmt.Errorf("%s: %s != %s", codec, got, expected)
+	}
+	return nil
+}
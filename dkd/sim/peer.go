@@ -0,0 +1,283 @@
+/* license: https://mit-license.org
+ *
+ *  Dao-Ke-Dao: Universal Message Module
+ *
+ *                                Written in 2022 by Moky <albert.moky@gmail.com>
+ *
+ * ==============================================================================
+ * The MIT License (MIT)
+ *
+ * Copyright (c) 2022 Albert Moky
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ * ==============================================================================
+ */
+package sim
+
+import (
+	"encoding/json"
+	"sync"
+	. "github.com/dimchat/dkd-go/dkd"
+	. "github.com/dimchat/dkd-go/protocol"
+	. "github.com/dimchat/mkm-go/crypto"
+	. "github.com/dimchat/mkm-go/format"
+	. "github.com/dimchat/mkm-go/protocol"
+	. "github.com/dimchat/mkm-go/types"
+)
+
+/**
+ *  Injected Crypto
+ *  ~~~~~~~~~~~~~~~
+ *  Key pairs of all peers, shared by the simulated network
+ *  (this package has no crypto implementations)
+ */
+type Crypto interface {
+
+	// new message key
+	GenerateKey() SymmetricKey
+
+	// message key from serialized info
+	ParseKey(info map[string]interface{}) SymmetricKey
+
+	// encrypt/decrypt message key with receiver's key pair
+	EncryptKey(data []byte, receiver ID) []byte
+	DecryptKey(data []byte, receiver ID) []byte
+
+	// sign/verify with sender's key pair,
+	// signature size must be plausible (see SignatureRuleSet)
+	Sign(data []byte, sender ID) []byte
+	Verify(data []byte, signature []byte, sender ID) bool
+}
+
+/**
+ *  Simulated Peer
+ *  ~~~~~~~~~~~~~~
+ *  Client which sends messages through the full cycle:
+ *
+ *      Instant --Encrypt--> Secure --Sign--> Reliable   (send)
+ *      Reliable --Verify--> Secure --Trim/Decrypt--> Instant   (receive)
+ *
+ *  and acts as the message delegate itself.
+ */
+type Peer struct {
+
+	_id ID
+	_crypto Crypto
+
+	_inbox []InstantMessage
+	_lock sync.Mutex
+}
+
+func NewPeer(identifier ID, crypto Crypto) *Peer {
+	peer := new(Peer)
+	peer.Init(identifier, crypto)
+	return peer
+}
+
+func (peer *Peer) Init(identifier ID, crypto Crypto) *Peer {
+	peer._id = identifier
+	peer._crypto = crypto
+	peer._inbox = make([]InstantMessage, 0)
+	return peer
+}
+
+func (peer *Peer) ID() ID {
+	return peer._id
+}
+
+/**
+ *  Pack content for the receiver
+ *
+ * @param receiver - user ID
+ * @param content  - message content
+ * @return signed message
+ */
+func (peer *Peer) Pack(receiver ID, content Content) ReliableMessage {
+	return peer.pack(receiver, content, nil)
+}
+
+/**
+ *  Pack content for the group, message key encrypted for each member
+ *
+ * @param group   - group ID
+ * @param members - group members
+ * @param content - message content
+ * @return signed message
+ */
+func (peer *Peer) PackGroup(group ID, members []ID, content Content) ReliableMessage {
+	return peer.pack(group, content, members)
+}
+
+func (peer *Peer) pack(receiver ID, content Content, members []ID) ReliableMessage {
+	env := EnvelopeCreate(peer._id, receiver, TimeNow())
+	iMsg := InstantMessageCreate(env, content)
+	if iMsg == nil {
+		return nil
+	}
+	iMsg.SetDelegate(peer)
+	var password SymmetricKey
+	if !receiver.IsBroadcast() {
+		password = peer._crypto.GenerateKey()
+	}
+	sMsg := iMsg.Encrypt(password, members)
+	if sMsg == nil {
+		return nil
+	}
+	sMsg.SetDelegate(peer)
+	return sMsg.Sign()
+}
+
+/**
+ *  Unpack message from the station
+ *
+ * @param rMsg - message delivered to this peer
+ * @return instant message, or error
+ */
+func (peer *Peer) Unpack(rMsg ReliableMessage) (InstantMessage, error) {
+	rMsg.SetDelegate(peer)
+	sMsg, err := SafeVerify(rMsg)
+	if err != nil {
+		return nil, err
+	}
+	if sMsg.EncryptedKeys() != nil {
+		// group message not split by station
+		if sMsg, err = sMsg.TrimE(peer._id); err != nil {
+			return nil, err
+		}
+	}
+	iMsg, err := SafeDecrypt(sMsg)
+	if err != nil {
+		return nil, err
+	}
+	if iMsg == nil {
+		return nil, ErrMessageMalformed
+	}
+	peer._lock.Lock()
+	peer._inbox = append(peer._inbox, iMsg)
+	peer._lock.Unlock()
+	return iMsg, nil
+}
+
+// copy of received messages
+func (peer *Peer) Inbox() []InstantMessage {
+	peer._lock.Lock()
+	defer peer._lock.Unlock()
+	inbox := make([]InstantMessage, len(peer._inbox))
+	copy(inbox, peer._inbox)
+	return inbox
+}
+
+//-------- IInstantMessageDelegate
+
+func (peer *Peer) SerializeContent(content Content, _ SymmetricKey, _ InstantMessage) []byte {
+	data, err := CanonicalJSON(content.Map())
+	if err != nil {
+		return nil
+	}
+	return data
+}
+
+func (peer *Peer) EncryptContent(data []byte, password SymmetricKey, _ InstantMessage) []byte {
+	return password.Encrypt(data)
+}
+
+func (peer *Peer) EncodeData(data []byte, _ InstantMessage) string {
+	return Base64Encode(data)
+}
+
+func (peer *Peer) SerializeKey(password SymmetricKey, _ InstantMessage) []byte {
+	data, err := CanonicalJSON(password.Map())
+	if err != nil {
+		return nil
+	}
+	return data
+}
+
+func (peer *Peer) EncryptKey(data []byte, receiver ID, _ InstantMessage) []byte {
+	return peer._crypto.EncryptKey(data, receiver)
+}
+
+func (peer *Peer) EncodeKey(data []byte, _ InstantMessage) string {
+	return Base64Encode(data)
+}
+
+//-------- ISecureMessageDelegate
+
+func (peer *Peer) DecodeKey(key interface{}, _ SecureMessage) []byte {
+	return decodeBase64(key)
+}
+
+func (peer *Peer) DecryptKey(key []byte, _ ID, _ ID, _ SecureMessage) []byte {
+	// receiver is the group ID for group message, use own key pair
+	return peer._crypto.DecryptKey(key, peer._id)
+}
+
+func (peer *Peer) DeserializeKey(key []byte, _ ID, _ ID, _ SecureMessage) SymmetricKey {
+	if key == nil {
+		// no key cache in simulation
+		return nil
+	}
+	var info map[string]interface{}
+	if err := json.Unmarshal(key, &info); err != nil {
+		return nil
+	}
+	return peer._crypto.ParseKey(info)
+}
+
+func (peer *Peer) DecodeData(data interface{}, _ SecureMessage) []byte {
+	return decodeBase64(data)
+}
+
+func (peer *Peer) DecryptContent(data []byte, password SymmetricKey, _ SecureMessage) []byte {
+	return password.Decrypt(data)
+}
+
+func (peer *Peer) DeserializeContent(data []byte, _ SymmetricKey, _ SecureMessage) Content {
+	var info map[string]interface{}
+	if err := json.Unmarshal(data, &info); err != nil {
+		return nil
+	}
+	return ContentParse(info)
+}
+
+func (peer *Peer) SignData(data []byte, sender ID, _ SecureMessage) []byte {
+	return peer._crypto.Sign(data, sender)
+}
+
+func (peer *Peer) EncodeSignature(signature []byte, _ SecureMessage) string {
+	return Base64Encode(signature)
+}
+
+//-------- IReliableMessageDelegate
+
+func (peer *Peer) DecodeSignature(signature interface{}, _ ReliableMessage) []byte {
+	return decodeBase64(signature)
+}
+
+func (peer *Peer) VerifyDataSignature(data []byte, signature []byte, sender ID, _ ReliableMessage) bool {
+	return peer._crypto.Verify(data, signature, sender)
+}
+
+func decodeBase64(value interface{}) []byte {
+	text, ok := value.(string)
+	if !ok {
+		return nil
+	}
+	return Base64Decode(text)
+}
@@ -0,0 +1,231 @@
+/* license: https://mit-license.org
+ *
+ *  Dao-Ke-Dao: Universal Message Module
+ *
+ *                                Written in 2022 by Moky <albert.moky@gmail.com>
+ *
+ * ==============================================================================
+ * The MIT License (MIT)
+ *
+ * Copyright (c) 2022 Albert Moky
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ * ==============================================================================
+ */
+package sim
+
+import (
+	"bytes"
+	"errors"
+	"sync"
+	. "github.com/dimchat/dkd-go/dkd"
+	. "github.com/dimchat/dkd-go/protocol"
+	. "github.com/dimchat/mkm-go/protocol"
+)
+
+var ErrPeerNotFound = errors.New("peer not found")
+
+/**
+ *  Simulated Station
+ *  ~~~~~~~~~~~~~~~~~
+ *  In-memory relay between peers; every message goes through the wire
+ *  format (canonical JsON, parsed back with limits) on each hop:
+ *
+ *      peer --> station: verify signature
+ *      station: split group message for each member (or forward the
+ *               whole message and let the members trim it)
+ *      station --> peers: unpack
+ *
+ *  Factories for IDs and contents must be installed before use
+ *  (by the MingKeMing plugins and the DIM core).
+ */
+type Station struct {
+
+	_delegate *Peer  // verifies messages with the shared crypto
+
+	_peers []*Peer
+	_groups map[string][]ID
+	_split bool
+
+	_traffic [][]byte
+	_lock sync.Mutex
+}
+
+func NewStation(identifier ID, crypto Crypto) *Station {
+	station := new(Station)
+	station.Init(identifier, crypto)
+	return station
+}
+
+func (station *Station) Init(identifier ID, crypto Crypto) *Station {
+	station._delegate = NewPeer(identifier, crypto)
+	station._peers = make([]*Peer, 0)
+	station._groups = make(map[string][]ID)
+	station._split = true
+	station._traffic = make([][]byte, 0)
+	return station
+}
+
+func (station *Station) Join(peer *Peer) {
+	station._lock.Lock()
+	defer station._lock.Unlock()
+	station._peers = append(station._peers, peer)
+}
+
+func (station *Station) SetMembers(group ID, members []ID) {
+	station._lock.Lock()
+	defer station._lock.Unlock()
+	station._groups[group.String()] = members
+}
+
+// true to split group messages on station (default), false to forward
+func (station *Station) SetSplitGroups(split bool) {
+	station._split = split
+}
+
+// copy of all frames passed through the station, in order
+func (station *Station) Traffic() [][]byte {
+	station._lock.Lock()
+	defer station._lock.Unlock()
+	traffic := make([][]byte, len(station._traffic))
+	copy(traffic, station._traffic)
+	return traffic
+}
+
+//-------- IDirectory
+
+func (station *Station) Lookup(receiver ID) []ID {
+	station._lock.Lock()
+	defer station._lock.Unlock()
+	targets := make([]ID, 0, len(station._peers))
+	for _, peer := range station._peers {
+		targets = append(targets, peer.ID())
+	}
+	return targets
+}
+
+/**
+ *  Send message from a peer through the station
+ *
+ * @param rMsg - message packed by sender
+ * @return messages unpacked by the receivers, in delivery order
+ */
+func (station *Station) Deliver(rMsg ReliableMessage) ([]InstantMessage, error) {
+	// 1. peer --> station
+	rMsg, err := station.wire(rMsg)
+	if err != nil {
+		return nil, err
+	}
+	rMsg.SetDelegate(station._delegate)
+	if _, err = SafeVerify(rMsg); err != nil {
+		return nil, err
+	}
+	// 2. dispatch
+	messages, err := station.dispatch(rMsg)
+	if err != nil {
+		return nil, err
+	}
+	// 3. station --> peers
+	received := make([]InstantMessage, 0, len(messages))
+	for _, item := range messages {
+		peer := station.peer(item.target)
+		if peer == nil {
+			return received, ErrPeerNotFound
+		}
+		msg, err := station.wire(item.msg)
+		if err != nil {
+			return received, err
+		}
+		iMsg, err := peer.Unpack(msg)
+		if err != nil {
+			return received, err
+		}
+		received = append(received, iMsg)
+	}
+	return received, nil
+}
+
+// message to be delivered to the target peer
+type delivery struct {
+	target ID
+	msg ReliableMessage
+}
+
+func (station *Station) dispatch(rMsg ReliableMessage) ([]delivery, error) {
+	receiver := rMsg.Receiver()
+	sender := rMsg.Sender()
+	if receiver.IsBroadcast() {
+		// broadcast message is not encrypted, deliver to all targets
+		messages := make([]delivery, 0)
+		for _, target := range ExpandReceiver(receiver, station) {
+			if !target.Equal(sender) && !target.Equal(receiver) {
+				messages = append(messages, delivery{target, rMsg})
+			}
+		}
+		return messages, nil
+	} else if !receiver.IsGroup() {
+		return []delivery{{receiver, rMsg}}, nil
+	}
+	station._lock.Lock()
+	members := station._groups[receiver.String()]
+	station._lock.Unlock()
+	messages := make([]delivery, 0, len(members))
+	if !station._split {
+		// forward the whole message, trimmed by the members themselves
+		for _, member := range members {
+			if !member.Equal(sender) {
+				messages = append(messages, delivery{member, rMsg})
+			}
+		}
+		return messages, nil
+	}
+	for _, sMsg := range rMsg.Split(members) {
+		member := sMsg.Receiver()
+		if member.Equal(sender) {
+			continue
+		}
+		if msg := ReliableMessageParse(sMsg.Map()); msg != nil {
+			messages = append(messages, delivery{member, msg})
+		}
+	}
+	return messages, nil
+}
+
+func (station *Station) peer(receiver ID) *Peer {
+	station._lock.Lock()
+	defer station._lock.Unlock()
+	for _, peer := range station._peers {
+		if peer.ID().Equal(receiver) {
+			return peer
+		}
+	}
+	return nil
+}
+
+// serialize & parse back, as on network
+func (station *Station) wire(rMsg ReliableMessage) (ReliableMessage, error) {
+	frame, err := CanonicalJSON(rMsg.Map())
+	if err != nil {
+		return nil, err
+	}
+	station._lock.Lock()
+	station._traffic = append(station._traffic, frame)
+	station._lock.Unlock()
+	return ParseReliableMessageReader(bytes.NewReader(frame), DefaultLimits())
+}
@@ -0,0 +1,85 @@
+/* license: https://mit-license.org
+ *
+ *  Dao-Ke-Dao: Universal Message Module
+ *
+ *                                Written in 2022 by Moky <albert.moky@gmail.com>
+ *
+ * ==============================================================================
+ * The MIT License (MIT)
+ *
+ * Copyright (c) 2022 Albert Moky
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ * ==============================================================================
+ */
+package dkd_test
+
+import (
+	"testing"
+	. "github.com/dimchat/dkd-go/dkd"
+	. "github.com/dimchat/dkd-go/protocol"
+	. "github.com/dimchat/mkm-go/protocol"
+	. "github.com/dimchat/mkm-go/types"
+)
+
+func TestSplitCarbonCopies(t *testing.T) {
+	alice, bob, carol := newPeer("alice@a1"), newPeer("bob@b1"), newPeer("carol@c1")
+	env := EnvelopeCreate(alice.ID(), bob.ID(), TimeNow())
+	env.SetReceivers([]ID{carol.ID()})
+	iMsg := NewInstantMessage(nil, env, textContent("hello"))
+	iMsg.SetDelegate(alice)
+	sMsg := iMsg.Encrypt(new(testCrypto).GenerateKey(), nil)
+	if sMsg == nil || sMsg.EncryptedKeys() == nil {
+		t.Fatal("failed to encrypt carbon copies")
+	}
+	messages := sMsg.SplitWithOptions([]ID{bob.ID(), carol.ID()}, nil)
+	if len(messages) != 2 {
+		t.Fatalf("expected 2 messages, got %d", len(messages))
+	}
+	for _, item := range messages {
+		if item.Get("group") != nil {
+			t.Fatalf("personal message split with group: %s", snapshot(item.Map()))
+		}
+		if item.Get("key") == nil {
+			t.Fatalf("key not moved: %s", snapshot(item.Map()))
+		}
+	}
+}
+
+func TestSplitHideGroupWithAAD(t *testing.T) {
+	alice, bob := newPeer("alice@a1"), newPeer("bob@b1")
+	env := EnvelopeCreate(alice.ID(), IDParse("team@gteam"), TimeNow())
+	iMsg := NewInstantMessage(nil, env, textContent("hello"))
+	iMsg.SetDelegate(alice)
+	info := iMsg.Encrypt(new(testCrypto).GenerateKey(), []ID{bob.ID()}).CopyMap(false)
+	SecureMessageSetAAD(info, AADVersion1)
+	sMsg := SecureMessageParse(info)
+
+	err := SafeCall(func() {
+		sMsg.SplitWithOptions([]ID{bob.ID()}, &SplitOptions{HideGroup: true})
+	})
+	if panicErr, ok := err.(*PanicError); !ok || panicErr.Value != ErrHideGroupWithAAD {
+		t.Fatalf("expected ErrHideGroupWithAAD, got %v", err)
+	}
+	if messages := sMsg.SplitWithOptions([]ID{bob.ID()}, nil); len(messages) != 1 {
+		t.Fatal("failed to split with group")
+	} else if string(MessageBuildAAD(messages[0].Map(), AADVersion1)) != string(MessageBuildAAD(info, AADVersion1)) {
+		t.Fatal("AAD changed after split")
+	}
+}
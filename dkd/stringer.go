@@ -0,0 +1,95 @@
+/* license: https://mit-license.org
+ *
+ *  Dao-Ke-Dao: Universal Message Module
+ *
+ *                                Written in 2022 by Moky <albert.moky@gmail.com>
+ *
+ * ==============================================================================
+ * The MIT License (MIT)
+ *
+ * Copyright (c) 2022 Albert Moky
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ * ==============================================================================
+ */
+package dkd
+
+import (
+	"fmt"
+	"strings"
+	. "github.com/dimchat/dkd-go/protocol"
+	. "github.com/dimchat/mkm-go/protocol"
+	. "github.com/dimchat/mkm-go/types"
+)
+
+/*
+ *  Compact Debug Formatting
+ *  ~~~~~~~~~~~~~~~~~~~~~~~~
+ *  "sender→receiver [TYPE sn@time]", with group ID appended if exists;
+ *  data, keys and signature are never printed, so '%v' is safe for logs.
+ */
+
+func (env *MessageEnvelope) String() string {
+	return describe(env.Sender(), env.Receiver(), env.Group(), env.Type(), 0, env.Time())
+}
+
+func (msg *BaseMessage) String() string {
+	env := msg.Envelope()
+	return describe(env.Sender(), env.Receiver(), env.Group(), env.Type(), 0, env.Time())
+}
+
+func (msg *PlainMessage) String() string {
+	content := msg.Content()
+	if content == nil {
+		return msg.BaseMessage.String()
+	}
+	return describe(msg.Sender(), msg.Receiver(), msg.Group(), content.Type(), content.SN(), msg.Time())
+}
+
+func describe(sender, receiver, group ID, msgType ContentType, sn uint64, when Time) string {
+	var sb strings.Builder
+	sb.WriteString(idString(sender))
+	sb.WriteString("→")
+	sb.WriteString(idString(receiver))
+	if group != nil && (receiver == nil || !group.Equal(receiver)) {
+		sb.WriteString(" (")
+		sb.WriteString(group.String())
+		sb.WriteString(")")
+	}
+	sb.WriteString(" [")
+	if msgType != 0 {
+		sb.WriteString(msgType.String())
+		sb.WriteString(" ")
+	}
+	if sn != 0 {
+		sb.WriteString(fmt.Sprintf("%d", sn))
+	}
+	if !TimeIsNil(when) {
+		sb.WriteString(fmt.Sprintf("@%d", Timestamp(when)))
+	}
+	sb.WriteString("]")
+	return sb.String()
+}
+
+func idString(id ID) string {
+	if id == nil {
+		return "?"
+	}
+	return id.String()
+}
@@ -0,0 +1,84 @@
+/* license: https://mit-license.org
+ *
+ *  Dao-Ke-Dao: Universal Message Module
+ *
+ *                                Written in 2022 by Moky <albert.moky@gmail.com>
+ *
+ * ==============================================================================
+ * The MIT License (MIT)
+ *
+ * Copyright (c) 2022 Albert Moky
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ * ==============================================================================
+ */
+package dkd
+
+import (
+	"math/rand"
+	. "github.com/dimchat/dkd-go/protocol"
+	. "github.com/dimchat/mkm-go/crypto"
+	. "github.com/dimchat/mkm-go/protocol"
+	. "github.com/dimchat/mkm-go/types"
+)
+
+/**
+ *  Test Vector
+ *  ~~~~~~~~~~~
+ *  Reference messages for validating other SDKs,
+ *  no clock or random source involved except the seed,
+ *  so the output is reproducible with a deterministic delegate.
+ */
+type VectorSpec struct {
+	Seed     int64
+	Sender   ID
+	Receiver ID
+	Time     Time
+	Type     ContentType
+	Fields   map[string]interface{}  // extra content fields
+}
+
+/**
+ *  Generate reference messages
+ *
+ * @param spec     - vector spec
+ * @param password - fixed symmetric key
+ * @param delegate - deterministic message delegate
+ * @return instant message and the signed reliable message
+ */
+func GenerateVector(spec *VectorSpec, password SymmetricKey, delegate MessageDelegate) (InstantMessage, ReliableMessage) {
+	// serial number from seed
+	sn := uint64(rand.New(rand.NewSource(spec.Seed)).Uint32())
+	if sn == 0 {
+		sn = 9527 + 9394
+	}
+	content := new(BaseContent).InitWithSN(spec.Type, sn, spec.Time)
+	for key, value := range spec.Fields {
+		content.Set(key, value)
+	}
+	env := NewEnvelope(nil, spec.Sender, spec.Receiver, spec.Time)
+	iMsg := NewInstantMessage(nil, env, content)
+	iMsg.SetDelegate(delegate)
+	sMsg := iMsg.Encrypt(password, nil)
+	if sMsg == nil {
+		return iMsg, nil
+	}
+	sMsg.SetDelegate(delegate)
+	return iMsg, sMsg.Sign()
+}
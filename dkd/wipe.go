@@ -0,0 +1,77 @@
+/* license: https://mit-license.org
+ *
+ *  Dao-Ke-Dao: Universal Message Module
+ *
+ *                                Written in 2022 by Moky <albert.moky@gmail.com>
+ *
+ * ==============================================================================
+ * The MIT License (MIT)
+ *
+ * Copyright (c) 2022 Albert Moky
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ * ==============================================================================
+ */
+package dkd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+/**
+ *  Message holding key material until 'Wipe()'
+ */
+type secretHolder interface {
+	Wipe()
+
+	// key material not wiped yet
+	hasSecrets() bool
+}
+
+/**
+ *  Report of messages collected without 'Wipe()' in hardened build
+ *
+ *  line format: "{time} unwiped {type}"
+ */
+var wipeWriter io.Writer = os.Stderr
+var wipeLock sync.Mutex
+
+func WipeSetWriter(writer io.Writer) {
+	wipeLock.Lock()
+	defer wipeLock.Unlock()
+	wipeWriter = writer
+}
+
+func reportUnwiped(msg secretHolder) {
+	wipeLock.Lock()
+	defer wipeLock.Unlock()
+	_, _ = fmt.Fprintf(wipeWriter, "%d unwiped %T\n", time.Now().UnixNano(), msg)
+}
+
+// zero the decrypted bytes, unless the delegate returned its input
+func wipeDecrypted(data []byte, input []byte) {
+	if len(data) > 0 && len(input) > 0 && &data[0] == &input[0] {
+		return
+	}
+	wipeBytes(data)
+}
@@ -0,0 +1,115 @@
+/* license: https://mit-license.org
+ *
+ *  Dao-Ke-Dao: Universal Message Module
+ *
+ *                                Written in 2022 by Moky <albert.moky@gmail.com>
+ *
+ * ==============================================================================
+ * The MIT License (MIT)
+ *
+ * Copyright (c) 2022 Albert Moky
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ * ==============================================================================
+ */
+package protocol
+
+import (
+	"strconv"
+	. "github.com/dimchat/mkm-go/crypto"
+)
+
+/**
+ *  Additional Authenticated Data
+ *  ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+ *  Binds envelope fields to the content encryption and the signature,
+ *  so header tampering by relays becomes detectable.
+ *
+ *  Version 1 covers the receiver before split (group ID, or receiver)
+ *  and 'time', plus the ratchet header if present:
+ *
+ *      aad = "{group or receiver}\n{time}"
+ *      aad = "{group or receiver}\n{time}\n{ratchet}\n{chain_idx}"
+ *
+ *  Messages with AAD are flagged with 'aad' (version), old clients that
+ *  don't know the flag will fail to verify them, so enable it only when
+ *  all peers support the version.
+ *  NOTICE: carbon copies (trimmed personal messages with 'receivers')
+ *          change the receiver, so Encrypt() never uses AAD for them.
+ */
+const AADVersion1 = 1
+
+var aadVersion = 0
+
+/**
+ *  Set AAD version for outgoing messages, 0 to disable (default)
+ */
+func AADSetVersion(version int) {
+	aadVersion = version
+}
+
+func AADGetVersion() int {
+	return aadVersion
+}
+
+/**
+ *  AAD Delegate
+ *  ~~~~~~~~~~~~
+ *  Optional interface for message delegate, encrypts content with AAD
+ *  (e.g.: AES-GCM); required for sending/receiving messages with 'aad'.
+ */
+type AADDelegate interface {
+
+	EncryptContentWithAAD(data []byte, aad []byte, password SymmetricKey, iMsg InstantMessage) []byte
+
+	DecryptContentWithAAD(data []byte, aad []byte, password SymmetricKey, sMsg SecureMessage) []byte
+}
+
+func SecureMessageGetAAD(msg map[string]interface{}) int {
+	version, _ := numberToUint64(msg["aad"])
+	return int(version)
+}
+
+func SecureMessageSetAAD(msg map[string]interface{}, version int) {
+	if version == 0 {
+		delete(msg, "aad")
+	} else {
+		msg["aad"] = version
+	}
+}
+
+/**
+ *  Build AAD from message fields
+ *
+ * @param msg     - message info
+ * @param version - AAD version
+ * @return nil for unknown version
+ */
+func MessageBuildAAD(msg map[string]interface{}, version int) []byte {
+	if version != AADVersion1 {
+		return nil
+	}
+	to, _ := msg["group"].(string)
+	if to == "" {
+		to, _ = msg["receiver"].(string)
+	}
+	seconds, _ := numberToFloat64(msg["time"])
+	aad := []byte(to + "\n" + strconv.FormatFloat(seconds, 'f', -1, 64))
+	return append(aad, MessageRatchetAAD(msg)...)
+}
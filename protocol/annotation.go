@@ -0,0 +1,142 @@
+/* license: https://mit-license.org
+ *
+ *  Dao-Ke-Dao: Universal Message Module
+ *
+ *                                Written in 2022 by Moky <albert.moky@gmail.com>
+ *
+ * ==============================================================================
+ * The MIT License (MIT)
+ *
+ * Copyright (c) 2022 Albert Moky
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ * ==============================================================================
+ */
+package protocol
+
+import (
+	"encoding/json"
+	"errors"
+)
+
+/**
+ *  Annotations
+ *  ~~~~~~~~~~~
+ *  Sidecar fields added to content by bots (translation, moderation, ...),
+ *  encrypted together with the content and opaque to the message layer.
+ *
+ *  data format: {
+ *      //...
+ *      'annotations' : {
+ *          'translation'  : {'language': 'en', 'text': '...'},
+ *          'moderation'   : {'labels': ['spam']},
+ *          'link_preview' : {...}
+ *      }
+ *  }
+ */
+const (
+	AnnotationTranslation = "translation"
+	AnnotationModeration  = "moderation"
+	AnnotationLinkPreview = "link_preview"
+)
+
+var ErrAnnotationTooLarge = errors.New("annotation too large")
+
+// max size of each annotation (bytes of JsON)
+var annotationMaxSize = 4096
+
+func AnnotationSetMaxSize(size int) {
+	annotationMaxSize = size
+}
+
+func ContentGetAnnotations(content map[string]interface{}) map[string]interface{} {
+	annotations, _ := content["annotations"].(map[string]interface{})
+	return annotations
+}
+
+func ContentGetAnnotation(content map[string]interface{}, name string) map[string]interface{} {
+	annotation, _ := ContentGetAnnotations(content)[name].(map[string]interface{})
+	return annotation
+}
+
+func ContentSetAnnotation(content map[string]interface{}, name string, annotation map[string]interface{}) error {
+	annotations := ContentGetAnnotations(content)
+	if annotation == nil {
+		if annotations != nil {
+			delete(annotations, name)
+			if len(annotations) == 0 {
+				delete(content, "annotations")
+			}
+		}
+		return nil
+	}
+	data, err := json.Marshal(annotation)
+	if err != nil {
+		return err
+	}
+	if len(data) > annotationMaxSize {
+		return ErrAnnotationTooLarge
+	}
+	if annotations == nil {
+		annotations = make(map[string]interface{})
+		content["annotations"] = annotations
+	}
+	annotations[name] = annotation
+	return nil
+}
+
+//
+//  Typed accessors
+//
+
+func ContentGetTranslation(content map[string]interface{}) (language string, text string) {
+	annotation := ContentGetAnnotation(content, AnnotationTranslation)
+	language, _ = annotation["language"].(string)
+	text, _ = annotation["text"].(string)
+	return language, text
+}
+
+func ContentSetTranslation(content map[string]interface{}, language string, text string) error {
+	return ContentSetAnnotation(content, AnnotationTranslation, map[string]interface{}{
+		"language": language,
+		"text":     text,
+	})
+}
+
+func ContentGetModerationLabels(content map[string]interface{}) []string {
+	annotation := ContentGetAnnotation(content, AnnotationModeration)
+	array, _ := annotation["labels"].([]interface{})
+	labels := make([]string, 0, len(array))
+	for _, item := range array {
+		if label, ok := item.(string); ok {
+			labels = append(labels, label)
+		}
+	}
+	return labels
+}
+
+func ContentSetModerationLabels(content map[string]interface{}, labels []string) error {
+	array := make([]interface{}, len(labels))
+	for i, label := range labels {
+		array[i] = label
+	}
+	return ContentSetAnnotation(content, AnnotationModeration, map[string]interface{}{
+		"labels": array,
+	})
+}
@@ -31,6 +31,7 @@
 package protocol
 
 import (
+	"sort"
 	. "github.com/dimchat/mkm-go/protocol"
 	. "github.com/dimchat/mkm-go/types"
 )
@@ -43,6 +44,8 @@ import (
  *  data format: {
  *      'type'    : 0x00,            // message type
  *      'sn'      : 0,               // serial number
+ *      'uuid'    : 'UUID',          // idempotency token, OPTIONAL
+ *      'prev'    : 'fingerprint',   // previous message of the sender, OPTIONAL
  *
  *      'group'   : 'Group ID',      // for group message
  *
@@ -60,6 +63,11 @@ type Content interface {
 
 	Time() Time  // message time
 
+	// Idempotency token for deduplicating retried sends,
+	// keep it when rebuilding content for retry (even with a new SN)
+	UUID() string
+	SetUUID(uuid string)
+
 	// Group ID/string for group message
 	//    if field 'group' exists, it means this is a group message
 	Group() ID
@@ -72,16 +80,46 @@ func ContentGetType(content map[string]interface{}) ContentType {
 }
 
 func ContentGetSN(content map[string]interface{}) uint64 {
-	sn := content["sn"]
-	if sn == nil {
-		return 0
-	}
-	return uint64(sn.(float64))
+	sn, _ := numberToUint64(content["sn"])
+	return sn
 }
 
 func ContentGetTime(content map[string]interface{}) Time {
 	timestamp := content["time"]
-	return TimeParse(timestamp)
+	return parseTime(timestamp)
+}
+
+func ContentGetUUID(content map[string]interface{}) string {
+	uuid, _ := content["uuid"].(string)
+	return uuid
+}
+
+func ContentSetUUID(content map[string]interface{}, uuid string) {
+	if uuid == "" {
+		delete(content, "uuid")
+	} else {
+		content["uuid"] = uuid
+	}
+}
+
+/**
+ *  Message Chain
+ *  ~~~~~~~~~~~~~
+ *  'prev' is the fingerprint of the sender's previous message in the
+ *  conversation, it's inside the encrypted content so relays can't
+ *  change it; receivers detect dropped messages by the broken chain.
+ */
+func ContentGetPrev(content map[string]interface{}) string {
+	prev, _ := content["prev"].(string)
+	return prev
+}
+
+func ContentSetPrev(content map[string]interface{}, fingerprint string) {
+	if fingerprint == "" {
+		delete(content, "prev")
+	} else {
+		content["prev"] = fingerprint
+	}
 }
 
 func ContentGetGroup(content map[string]interface{}) ID {
@@ -116,6 +154,7 @@ type ContentFactory interface {
 //
 var contentFactories = make(map[ContentType]ContentFactory)
 
+// replace the current factory
 func ContentSetFactory(msgType ContentType, factory ContentFactory) {
 	contentFactories[msgType] = factory
 }
@@ -124,23 +163,61 @@ func ContentGetFactory(msgType ContentType) ContentFactory {
 	return contentFactories[msgType]
 }
 
+func ContentRemoveFactory(msgType ContentType) {
+	delete(contentFactories, msgType)
+}
+
+// content types with factory registered, in ascending order
+func ContentTypesRegistered() []ContentType {
+	types := make([]ContentType, 0, len(contentFactories))
+	for msgType := range contentFactories {
+		types = append(types, msgType)
+	}
+	sort.Slice(types, func(i, j int) bool {
+		return types[i] < types[j]
+	})
+	return types
+}
+
 //
 //  Factory method
 //
 func ContentParse(content interface{}) Content {
+	value, _ := ContentParseE(content)
+	return value
+}
+
+/**
+ *  Parse content, report why it failed
+ *
+ * @return *FactoryNotSetError, or error from ContentValidate (strict mode)
+ */
+func ContentParseE(content interface{}) (Content, error) {
 	if ValueIsNil(content) {
-		return nil
+		return nil, nil
 	}
 	value, ok := content.(Content)
 	if ok {
-		return value
+		return value, nil
 	}
 	info := FetchMap(content)
+	info = applyPatches(PatchContent, info)
+	if transcoder := ContentTranscoderGet(); transcoder != nil {
+		info = transcoder.Import(info)
+	}
+	if contentStrict {
+		if err := ContentValidate(info); err != nil {
+			return nil, err
+		}
+	}
 	// get content factory by type
 	msgType := ContentGetType(info)
 	factory := ContentGetFactory(msgType)
 	if factory == nil {
+		if err := requireFactory("content", func() bool { return contentFactories[0] != nil }); err != nil {
+			return nil, err
+		}
 		factory = ContentGetFactory(0)  // unknown
 	}
-	return factory.ParseContent(info)
+	return factory.ParseContent(info), nil
 }
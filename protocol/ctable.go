@@ -0,0 +1,114 @@
+/* license: https://mit-license.org
+ *
+ *  Dao-Ke-Dao: Universal Message Module
+ *
+ *                                Written in 2022 by Moky <albert.moky@gmail.com>
+ *
+ * ==============================================================================
+ * The MIT License (MIT)
+ *
+ * Copyright (c) 2022 Albert Moky
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ * ==============================================================================
+ */
+package protocol
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+/**
+ *  Content Type Table
+ *  ~~~~~~~~~~~~~~~~~~
+ *  Enable content types at runtime from a JsON descriptor
+ *
+ *  data format: {
+ *      version : 1,
+ *      types   : [
+ *          {
+ *              name    : "TEXT",  // alias
+ *              code    : 1,       // content type
+ *              factory : "text"   // factory id, OPTIONAL
+ *          },
+ *          //...
+ *      ]
+ *  }
+ */
+type ContentTypeTable struct {
+	Version int                    `json:"version"`
+	Types   []ContentTypeTableItem `json:"types"`
+}
+
+type ContentTypeTableItem struct {
+	Name    string `json:"name"`
+	Code    uint   `json:"code"`
+	Factory string `json:"factory,omitempty"`
+}
+
+const ContentTypeTableVersion = 1
+
+//
+//  Content factories by id, for loading from table
+//
+var contentFactoryIDs = make(map[string]ContentFactory)
+
+func ContentFactoryRegister(id string, factory ContentFactory) {
+	contentFactoryIDs[id] = factory
+}
+
+func ContentFactoryLookup(id string) ContentFactory {
+	return contentFactoryIDs[id]
+}
+
+/**
+ *  Load content types from JsON descriptor
+ *
+ * @param data - JsON data
+ * @return error when the table is invalid, nothing will be loaded then
+ */
+func ContentTypeLoadTable(data []byte) error {
+	var table ContentTypeTable
+	if err := json.Unmarshal(data, &table); err != nil {
+		return err
+	}
+	if table.Version != ContentTypeTableVersion {
+		return fmt.Errorf("content type table version not supported: %d", table.Version)
+	}
+	// check all items before loading
+	for _, item := range table.Types {
+		if item.Code == 0 || item.Code > 0xFF {
+			return fmt.Errorf("content type code out of range: %s=%d", item.Name, item.Code)
+		}
+		if item.Factory != "" && contentFactoryIDs[item.Factory] == nil {
+			return fmt.Errorf("content factory not registered: %s", item.Factory)
+		}
+	}
+	for _, item := range table.Types {
+		msgType := ContentType(item.Code)
+		if item.Name != "" {
+			ContentTypeSetAlias(msgType, item.Name)
+		}
+		if item.Factory != "" {
+			ContentSetFactory(msgType, contentFactoryIDs[item.Factory])
+		}
+	}
+	return nil
+}
@@ -115,7 +115,12 @@ func ContentTypeParse(msgType interface{}) ContentType {
 	if ValueIsNil(msgType) {
 		return 0
 	}
-	return ContentType(msgType.(float64))
+	if text, ok := msgType.(string); ok {
+		// string-based type from newer SDKs
+		return ContentTypeFromString(text)
+	}
+	value, _ := numberToUint64(msgType)
+	return ContentType(value)
 }
 
 func (msgType ContentType) String() string {
@@ -132,6 +137,18 @@ func ContentTypeGetAlias(msgType ContentType) string {
 func ContentTypeSetAlias(msgType ContentType, alias string) {
 	msgTypeNames[msgType] = alias
 }
+func ContentTypeRemoveAlias(msgType ContentType) {
+	delete(msgTypeNames, msgType)
+}
+
+// copy of the alias table
+func ContentTypeAliases() map[ContentType]string {
+	aliases := make(map[ContentType]string, len(msgTypeNames))
+	for msgType, alias := range msgTypeNames {
+		aliases[msgType] = alias
+	}
+	return aliases
+}
 
 var msgTypeNames = make(map[ContentType]string, 15)
 
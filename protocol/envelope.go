@@ -85,23 +85,49 @@ type Envelope interface {
 	 */
 	Type() ContentType
 	SetType(msgType ContentType)
+
+	/*
+	 *  Scheduled Message
+	 *  ~~~~~~~~~~~~~~~~~
+	 *  the message should not be delivered before this time
+	 */
+	SendAfter() Time
+	SetSendAfter(when Time)
+
+	/*
+	 *  No Acknowledgement
+	 *  ~~~~~~~~~~~~~~~~~~
+	 *  hint for the receiver not to respond receipts,
+	 *  for transient contents such as presence or typing
+	 */
+	NoAck() bool
+	SetNoAck(flag bool)
+
+	/*
+	 *  Carbon Copy Receivers
+	 *  ~~~~~~~~~~~~~~~~~~~~~
+	 *  other direct recipients of a personal message (not a group),
+	 *  the message key will be encrypted for each of them into 'keys'
+	 */
+	Receivers() []ID
+	SetReceivers(receivers []ID)
 }
 
 func EnvelopeGetSender(env map[string]interface{}) ID {
-	return IDParse(env["sender"])
+	return resolveID(env["sender"])
 }
 
 func EnvelopeGetReceiver(env map[string]interface{}) ID {
-	return IDParse(env["receiver"])
+	return resolveID(env["receiver"])
 }
 
 func EnvelopeGetTime(env map[string]interface{}) Time {
 	timestamp := env["time"]
-	return TimeParse(timestamp)
+	return parseTime(timestamp)
 }
 
 func EnvelopeGetGroup(env map[string]interface{}) ID {
-	return IDParse(env["group"])
+	return resolveID(env["group"])
 }
 
 func EnvelopeSetGroup(env map[string]interface{}, group ID) {
@@ -113,11 +139,7 @@ func EnvelopeSetGroup(env map[string]interface{}, group ID) {
 }
 
 func EnvelopeGetType(env map[string]interface{}) ContentType {
-	msgType := env["type"]
-	if msgType == nil {
-		return 0
-	}
-	return ContentType(msgType.(float64))
+	return ContentTypeParse(env["type"])
 }
 
 func EnvelopeSetType(env map[string]interface{}, msgType ContentType) {
@@ -128,6 +150,65 @@ func EnvelopeSetType(env map[string]interface{}, msgType ContentType) {
 	}
 }
 
+func EnvelopeGetSendAfter(env map[string]interface{}) Time {
+	return parseTime(env["send_after"])
+}
+
+func EnvelopeSetSendAfter(env map[string]interface{}, when Time) {
+	if TimeIsNil(when) {
+		delete(env, "send_after")
+	} else {
+		env["send_after"] = TimeToFloat64(when)
+	}
+}
+
+func EnvelopeGetNoAck(env map[string]interface{}) bool {
+	flag, _ := env["no_ack"].(bool)
+	return flag
+}
+
+func EnvelopeSetNoAck(env map[string]interface{}, flag bool) {
+	if flag {
+		env["no_ack"] = true
+	} else {
+		delete(env, "no_ack")
+	}
+}
+
+func EnvelopeGetReceivers(env map[string]interface{}) []ID {
+	receivers := env["receivers"]
+	if receivers == nil {
+		return nil
+	}
+	return IDConvert(receivers)
+}
+
+func EnvelopeSetReceivers(env map[string]interface{}, receivers []ID) {
+	if len(receivers) == 0 {
+		delete(env, "receivers")
+	} else {
+		env["receivers"] = IDRevert(receivers)
+	}
+}
+
+/**
+ *  Carbon Copy
+ *  ~~~~~~~~~~~
+ *  copy of an outgoing message for the sender's other devices,
+ *  'carbon' keeps the original receiver (contact or group) ID
+ */
+func EnvelopeGetCarbon(env map[string]interface{}) ID {
+	return IDParse(env["carbon"])
+}
+
+func EnvelopeSetCarbon(env map[string]interface{}, receiver ID) {
+	if ValueIsNil(receiver) {
+		delete(env, "carbon")
+	} else {
+		env["carbon"] = receiver.String()
+	}
+}
+
 /**
  *  Envelope Factory
  *  ~~~~~~~~~~~~~~~~
@@ -158,6 +239,7 @@ type EnvelopeFactory interface {
 //
 var envelopeFactory EnvelopeFactory = nil
 
+// replace the current factory
 func EnvelopeSetFactory(factory EnvelopeFactory) {
 	envelopeFactory = factory
 }
@@ -170,20 +252,36 @@ func EnvelopeGetFactory() EnvelopeFactory {
 //  Factory methods
 //
 func EnvelopeCreate(from ID, to ID, when Time) Envelope {
+	env, _ := EnvelopeCreateE(from, to, when)
+	return env
+}
+
+func EnvelopeCreateE(from ID, to ID, when Time) (Envelope, error) {
+	if err := requireFactory("envelope", func() bool { return envelopeFactory != nil }); err != nil {
+		return nil, err
+	}
 	factory := EnvelopeGetFactory()
-	return factory.CreateEnvelope(from, to, when)
+	return factory.CreateEnvelope(from, to, when), nil
 }
 
 func EnvelopeParse(env interface{}) Envelope {
+	value, _ := EnvelopeParseE(env)
+	return value
+}
+
+func EnvelopeParseE(env interface{}) (Envelope, error) {
 	if ValueIsNil(env) {
-		return nil
+		return nil, nil
 	}
 	value, ok := env.(Envelope)
 	if ok {
-		return value
+		return value, nil
 	}
 	info := FetchMap(env)
+	if err := requireFactory("envelope", func() bool { return envelopeFactory != nil }); err != nil {
+		return nil, err
+	}
 	// create by envelope factory
 	factory := EnvelopeGetFactory()
-	return factory.ParseEnvelope(info)
+	return factory.ParseEnvelope(info), nil
 }
@@ -0,0 +1,79 @@
+/* license: https://mit-license.org
+ *
+ *  Dao-Ke-Dao: Universal Message Module
+ *
+ *                                Written in 2022 by Moky <albert.moky@gmail.com>
+ *
+ * ==============================================================================
+ * The MIT License (MIT)
+ *
+ * Copyright (c) 2022 Albert Moky
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ * ==============================================================================
+ */
+package protocol
+
+import "fmt"
+
+/**
+ *  Factory Not Set Error
+ *  ~~~~~~~~~~~~~~~~~~~~~
+ *  Returned by the *E functions when parsing/creating without the factory
+ *  installed, usually because the package "github.com/dimchat/dkd-go/dkd"
+ *  is not imported; the other functions return nil (or zero) instead.
+ */
+type FactoryNotSetError struct {
+	Name string
+}
+
+func (err *FactoryNotSetError) Error() string {
+	return fmt.Sprintf("dkd: %s factory not set, import \"github.com/dimchat/dkd-go/dkd\"" +
+		" or set the factory before using it", err.Name)
+}
+
+//
+//  Loader for default factories
+//
+var factoriesLoader func() = nil
+
+func FactoriesSetLoader(loader func()) {
+	factoriesLoader = loader
+}
+
+/**
+ *  Check factory before using it
+ *
+ * @param name   - factory name for error message
+ * @param exists - check whether the factory is set
+ * @return *FactoryNotSetError when factory not set
+ */
+func requireFactory(name string, exists func() bool) error {
+	if exists() {
+		return nil
+	}
+	// try to install default factories
+	if factoriesLoader != nil {
+		factoriesLoader()
+		if exists() {
+			return nil
+		}
+	}
+	return &FactoryNotSetError{Name: name}
+}
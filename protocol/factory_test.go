@@ -0,0 +1,58 @@
+/* license: https://mit-license.org
+ *
+ *  Dao-Ke-Dao: Universal Message Module
+ *
+ *                                Written in 2022 by Moky <albert.moky@gmail.com>
+ *
+ * ==============================================================================
+ * The MIT License (MIT)
+ *
+ * Copyright (c) 2022 Albert Moky
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ * ==============================================================================
+ */
+package protocol_test
+
+import (
+	"errors"
+	"testing"
+	. "github.com/dimchat/dkd-go/protocol"
+)
+
+// package dkd not imported, no factories installed
+func TestParseWithoutFactory(t *testing.T) {
+	info := map[string]interface{}{
+		"sender": "alice@a1",
+		"receiver": "bob@b1",
+		"data": "AAAA",
+		"signature": "AAAA",
+	}
+	if ReliableMessageParse(info) != nil {
+		t.Fatal("expected nil without factory")
+	}
+	_, err := ReliableMessageParseE(info)
+	var factoryErr *FactoryNotSetError
+	if !errors.As(err, &factoryErr) {
+		t.Fatalf("expected FactoryNotSetError, got: %v", err)
+	}
+	if _, err = EnvelopeParseE(info); err == nil {
+		t.Fatal("expected FactoryNotSetError for envelope")
+	}
+}
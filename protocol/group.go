@@ -0,0 +1,153 @@
+/* license: https://mit-license.org
+ *
+ *  Dao-Ke-Dao: Universal Message Module
+ *
+ *                                Written in 2022 by Moky <albert.moky@gmail.com>
+ *
+ * ==============================================================================
+ * The MIT License (MIT)
+ *
+ * Copyright (c) 2022 Albert Moky
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ * ==============================================================================
+ */
+package protocol
+
+import (
+	. "github.com/dimchat/mkm-go/protocol"
+)
+
+/**
+ *  Group Precedence
+ *  ~~~~~~~~~~~~~~~~
+ *  Group ID can appear both in the envelope (after split/trim) and in the
+ *  content; when they are different, the winner decides the group of the
+ *  instant message, and the other one will be overwritten while parsing.
+ *
+ *  Content wins by default, because the content was encrypted by the sender,
+ *  while the envelope could be rewritten by anyone on the route.
+ */
+type GroupPrecedence uint8
+
+const (
+	GroupFromContent  GroupPrecedence = 0  // trust 'content.group' (default)
+	GroupFromEnvelope GroupPrecedence = 1  // trust 'group' in envelope
+)
+
+var groupPrecedence = GroupFromContent
+
+func GroupPrecedenceSet(precedence GroupPrecedence) {
+	groupPrecedence = precedence
+}
+
+func GroupPrecedenceGet() GroupPrecedence {
+	return groupPrecedence
+}
+
+/**
+ *  Get group ID of the instant message by precedence,
+ *  falls back to the other source when the preferred one is missing
+ *
+ * @param head - message envelope
+ * @param body - message content
+ * @return group ID, nil for personal message
+ */
+func MessageGetGroup(head Envelope, body Content) ID {
+	envGroup := head.Group()
+	contentGroup := body.Group()
+	if groupPrecedence == GroupFromEnvelope {
+		if envGroup != nil {
+			return envGroup
+		}
+		return contentGroup
+	}
+	if contentGroup != nil {
+		return contentGroup
+	}
+	return envGroup
+}
+
+/**
+ *  Normalize the instant message info, make the group IDs in envelope
+ *  and content the same (by precedence)
+ *
+ *  Only for group messages: 'group' exists in envelope, or the receiver
+ *  is a group; a personal message may carry group content (e.g. a query
+ *  sent to the group owner), its 'group' stays in content only.
+ *
+ * @param info - instant message info, will not be modified
+ * @return reconciled info
+ */
+func InstantMessageReconcileGroup(info map[string]interface{}) map[string]interface{} {
+	content, ok := info["content"].(map[string]interface{})
+	if !ok {
+		return info
+	}
+	envGroup, _ := info["group"].(string)
+	contentGroup, _ := content["group"].(string)
+	if envGroup == contentGroup {
+		return info
+	}
+	if envGroup == "" {
+		receiver := IDParse(info["receiver"])
+		if receiver == nil || !receiver.IsGroup() {
+			// personal message with group content
+			return info
+		}
+	}
+	winner := contentGroup
+	if groupPrecedence == GroupFromEnvelope && envGroup != "" || contentGroup == "" {
+		winner = envGroup
+	}
+	info = copyFields(info)
+	content = copyFields(content)
+	info["group"] = winner
+	content["group"] = winner
+	info["content"] = content
+	return info
+}
+
+/**
+ *  Check whether the message is sent to a group,
+ *  which is not split (receiver is the group ID) or split for a member
+ */
+func IsGroupMessage(msg Message) bool {
+	return msg.Group() != nil || msg.Receiver().IsGroup()
+}
+
+/**
+ *  Check whether the group message was split/trimmed for a member,
+ *  the group ID was moved to 'group' and 'receiver' is the member ID
+ */
+func IsSplitGroupMessage(msg Message) bool {
+	return msg.Group() != nil && !msg.Receiver().IsGroup()
+}
+
+/**
+ *  Get the receiver before split, whose key encrypts the message:
+ *  the group ID for group message, or the receiver for personal message
+ */
+func ExpandedReceiver(msg Message) ID {
+	group := msg.Group()
+	if group == nil {
+		return msg.Receiver()
+	}
+	return group
+}
@@ -31,6 +31,7 @@
 package protocol
 
 import (
+	"errors"
 	. "github.com/dimchat/mkm-go/crypto"
 	. "github.com/dimchat/mkm-go/protocol"
 	. "github.com/dimchat/mkm-go/types"
@@ -54,6 +55,11 @@ type InstantMessage interface {
 
 	Content() Content
 
+	/**
+	 *  Remove the 'password' attachment from content after processing
+	 */
+	Wipe()
+
 	/*
 	 *  Encrypt the Instant Message to Secure Message
 	 *
@@ -70,9 +76,9 @@ type InstantMessage interface {
 	/**
 	 *  Encrypt message, replace 'content' field with encrypted 'data'
 	 *
-	 * @param password - symmetric key
+	 * @param password - symmetric key; nil for plaintext message
 	 * @param members  - group members; nil for personal message
-	 * @return SecureMessage object
+	 * @return SecureMessage object; nil when blocked by moderation hook
 	 */
 	Encrypt(password SymmetricKey, members []ID) SecureMessage
 }
@@ -119,6 +125,7 @@ type InstantMessageFactory interface {
 //
 var instantFactory InstantMessageFactory = nil
 
+// replace the current factory
 func InstantMessageSetFactory(factory InstantMessageFactory) {
 	instantFactory = factory
 }
@@ -130,26 +137,95 @@ func InstantMessageGetFactory() InstantMessageFactory {
 //
 //  Factory methods
 //
+var (
+	ErrGroupNotTargeted = errors.New("group content must target the group or carry 'group' in envelope")
+	ErrGroupMismatch    = errors.New("group in envelope and content not match")
+)
+
+/**
+ *  Check group semantics between envelope and content:
+ *      1. group content must be sent to the group,
+ *         or to a member with the same 'group' in envelope;
+ *      2. 'group' in envelope must be the same as in content.
+ */
+func InstantMessageValidate(head Envelope, body Content) error {
+	envGroup := head.Group()
+	contentGroup := body.Group()
+	if contentGroup == nil {
+		if envGroup != nil {
+			return ErrGroupMismatch
+		}
+		return nil
+	}
+	if envGroup != nil {
+		if !envGroup.Equal(contentGroup) {
+			return ErrGroupMismatch
+		}
+		return nil
+	}
+	if !head.Receiver().Equal(contentGroup) {
+		return ErrGroupNotTargeted
+	}
+	return nil
+}
+
 func InstantMessageCreate(head Envelope, body Content) InstantMessage {
+	if requireFactory("instant message", func() bool { return instantFactory != nil }) != nil {
+		return nil
+	}
 	factory := InstantMessageGetFactory()
 	return factory.CreateInstantMessage(head, body)
 }
 
+/**
+ *  Create instant message after checking group semantics
+ *
+ * @return ErrGroupNotTargeted/ErrGroupMismatch (see InstantMessageValidate),
+ *         or *FactoryNotSetError
+ */
+func InstantMessageCreateE(head Envelope, body Content) (InstantMessage, error) {
+	if err := InstantMessageValidate(head, body); err != nil {
+		return nil, err
+	}
+	if err := requireFactory("instant message", func() bool { return instantFactory != nil }); err != nil {
+		return nil, err
+	}
+	return InstantMessageCreate(head, body), nil
+}
+
 func InstantMessageParse(msg interface{}) InstantMessage {
+	value, _ := InstantMessageParseE(msg)
+	return value
+}
+
+func InstantMessageParseE(msg interface{}) (InstantMessage, error) {
 	if ValueIsNil(msg) {
-		return nil
+		return nil, nil
 	}
 	value, ok := msg.(InstantMessage)
 	if ok {
-		return value
+		return value, nil
 	}
 	info := FetchMap(msg)
+	info = applyPatches(PatchInstant, info)
+	info = InstantMessageReconcileGroup(info)
+	if err := requireFactory("instant message", func() bool { return instantFactory != nil }); err != nil {
+		return nil, err
+	}
 	// create by message factory
 	factory := InstantMessageGetFactory()
-	return factory.ParseInstantMessage(info)
+	return factory.ParseInstantMessage(info), nil
 }
 
+/**
+ *  Generate serial number for content
+ *
+ * @return 0 when factory not set
+ */
 func InstantMessageGenerateSerialNumber(msgType ContentType, now Time) uint64 {
+	if requireFactory("instant message", func() bool { return instantFactory != nil }) != nil {
+		return 0
+	}
 	factory := InstantMessageGetFactory()
 	return factory.GenerateSerialNumber(msgType, now)
 }
@@ -0,0 +1,111 @@
+/* license: https://mit-license.org
+ *
+ *  Dao-Ke-Dao: Universal Message Module
+ *
+ *                                Written in 2022 by Moky <albert.moky@gmail.com>
+ *
+ * ==============================================================================
+ * The MIT License (MIT)
+ *
+ * Copyright (c) 2022 Albert Moky
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ * ==============================================================================
+ */
+package protocol
+
+import (
+	. "github.com/dimchat/mkm-go/protocol"
+)
+
+/**
+ *  Mentions
+ *  ~~~~~~~~
+ *  Members mentioned in group message content
+ *
+ *  data format: {
+ *      //...
+ *      'mentions' : ["{ID1}", "{ID2}", "@all"]
+ *  }
+ */
+const MentionAll = "@all"
+
+func ContentGetMentions(content map[string]interface{}) []interface{} {
+	mentions, _ := content["mentions"].([]interface{})
+	return mentions
+}
+
+func ContentSetMentions(content map[string]interface{}, members []ID, all bool) {
+	mentions := make([]interface{}, 0, len(members) + 1)
+	for _, item := range members {
+		mentions = append(mentions, item.String())
+	}
+	if all {
+		mentions = append(mentions, MentionAll)
+	}
+	if len(mentions) == 0 {
+		delete(content, "mentions")
+	} else {
+		content["mentions"] = mentions
+	}
+}
+
+/**
+ *  Get member IDs mentioned in content ('@all' excluded)
+ */
+func ExtractMentions(content Content) []ID {
+	mentions := ContentGetMentions(content.Map())
+	members := make([]ID, 0, len(mentions))
+	for _, item := range mentions {
+		if item == MentionAll {
+			continue
+		}
+		if member := IDParse(item); member != nil {
+			members = append(members, member)
+		}
+	}
+	return members
+}
+
+/**
+ *  Check whether all members are mentioned ('@all' or 'everyone@everywhere')
+ */
+func MentionsAll(content Content) bool {
+	for _, item := range ContentGetMentions(content.Map()) {
+		if item == MentionAll {
+			return true
+		}
+		if member := IDParse(item); member != nil && member.IsBroadcast() && member.IsGroup() {
+			return true
+		}
+	}
+	return false
+}
+
+func MentionsMe(content Content, me ID) bool {
+	if MentionsAll(content) {
+		return true
+	}
+	for _, member := range ExtractMentions(content) {
+		if member.Equal(me) {
+			return true
+		}
+	}
+	return false
+}
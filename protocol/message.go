@@ -31,6 +31,9 @@
 package protocol
 
 import (
+	"context"
+	"errors"
+	"strconv"
 	. "github.com/dimchat/mkm-go/crypto"
 	. "github.com/dimchat/mkm-go/protocol"
 	. "github.com/dimchat/mkm-go/types"
@@ -93,6 +96,21 @@ func MessageGetEnvelope(msg map[string]interface{}) Envelope {
 	return EnvelopeParse(msg)
 }
 
+var ErrDelegateNotSet = errors.New("message delegate not set")
+
+//
+//  Default delegate for messages without delegate set
+//
+var defaultDelegate MessageDelegate = nil
+
+func MessageSetDefaultDelegate(delegate MessageDelegate) {
+	defaultDelegate = delegate
+}
+
+func MessageGetDefaultDelegate() MessageDelegate {
+	return defaultDelegate
+}
+
 /**
  *  Message Delegate
  *  ~~~~~~~~~~~~~~~~
@@ -273,6 +291,212 @@ type SecureMessageDelegate interface {
 	EncodeSignature(signature []byte, sMsg SecureMessage) string
 }
 
+/**
+ *  Key Digest Delegate
+ *  ~~~~~~~~~~~~~~~~~~~
+ *  Optional interface for message delegate, supports reused keys
+ *  referenced by 'key_digest' instead of sending 'key'/'keys' again.
+ */
+type KeyDigestDelegate interface {
+
+	/**
+	 *  Get digest of the reused key (when SerializeKey() returns nil)
+	 *
+	 * @param password - symmetric key
+	 * @param iMsg     - instant message object
+	 * @return key digest; empty string for no digest
+	 */
+	DigestKey(password SymmetricKey, iMsg InstantMessage) string
+
+	/**
+	 *  Request the key from sender when not found in cache
+	 *  (DeserializeKey() returns nil for the 'key_digest')
+	 *
+	 * @param digest - key digest
+	 * @param sMsg   - secure message object
+	 */
+	RequestKey(digest string, sMsg SecureMessage)
+}
+
+/**
+ *  Async Delegate
+ *  ~~~~~~~~~~~~~~
+ *  Optional interface for message delegate, for private keys kept in
+ *  HSM/remote KMS which can't complete synchronously;
+ *  when implemented, SignData/DecryptKey are replaced by these methods,
+ *  and SignContext()/DecryptContext() await the results (or ctx.Done()).
+ *
+ *  The channel should receive exactly one value (nil on failure).
+ */
+type AsyncDelegate interface {
+
+	SignDataAsync(ctx context.Context, data []byte, sender ID, sMsg SecureMessage) <-chan []byte
+
+	DecryptKeyAsync(ctx context.Context, key []byte, sender ID, receiver ID, sMsg SecureMessage) <-chan []byte
+}
+
+/**
+ *  Cipher Delegate
+ *  ~~~~~~~~~~~~~~~
+ *  Optional interface for message delegate, names the content encryption
+ *  algorithm (e.g.: "AES-256-GCM") as 'cipher' in secure message,
+ *  so DecryptContent() can pick the right one while migrating algorithms.
+ */
+type CipherDelegate interface {
+
+	/**
+	 *  Get name of the algorithm used by EncryptContent()
+	 *
+	 * @param password - symmetric key
+	 * @param iMsg     - instant message object
+	 * @return cipher name; empty string for default
+	 */
+	ContentCipher(password SymmetricKey, iMsg InstantMessage) string
+}
+
+/**
+ *  Session Key Provider
+ *  ~~~~~~~~~~~~~~~~~~~~
+ *  Extension seam for ratcheting sessions (X3DH / Double Ratchet),
+ *  supplied by the message delegate (SessionKeyDelegate): Encrypt takes
+ *  the message key from it for personal messages (instead of the given
+ *  password, and without 'key'), Decrypt looks up the message key by the
+ *  ratchet header; the ratchet header is carried in the message, and bound
+ *  to the signature and AAD (see MessageRatchetAAD):
+ *
+ *  data format: {
+ *      //...
+ *      ratchet   : "...",  // ratchet public key (base64)
+ *      chain_idx : 0       // message index in the sending chain
+ *  }
+ */
+type SessionKeyProvider interface {
+
+	/**
+	 *  Derive the next message key for sending
+	 *
+	 * @param sender   - sender ID
+	 * @param receiver - receiver ID
+	 * @return message key and ratchet header
+	 */
+	Advance(sender ID, receiver ID) (SymmetricKey, *RatchetHeader)
+
+	/**
+	 *  Get the message key for a received ratchet header
+	 *
+	 * @param sender   - sender ID
+	 * @param receiver - receiver ID
+	 * @param header   - ratchet header in message
+	 * @return message key; nil if not derivable
+	 */
+	Lookup(sender ID, receiver ID, header *RatchetHeader) SymmetricKey
+
+	/**
+	 *  Confirm the session state after the message sent or decrypted
+	 *
+	 * @param sender   - sender ID
+	 * @param receiver - receiver ID
+	 * @param header   - ratchet header
+	 */
+	Commit(sender ID, receiver ID, header *RatchetHeader)
+}
+
+type RatchetHeader struct {
+	Ratchet    string
+	ChainIndex uint64
+}
+
+/**
+ *  Session Key Delegate
+ *  ~~~~~~~~~~~~~~~~~~~~
+ *  Optional interface for message delegate, supplies the ratchet sessions
+ */
+type SessionKeyDelegate interface {
+
+	// nil for no ratchet sessions
+	SessionKeys() SessionKeyProvider
+}
+
+func MessageGetRatchetHeader(msg map[string]interface{}) *RatchetHeader {
+	ratchet, ok := msg["ratchet"].(string)
+	if !ok {
+		return nil
+	}
+	header := &RatchetHeader{Ratchet: ratchet}
+	header.ChainIndex, _ = numberToUint64(msg["chain_idx"])
+	return header
+}
+
+func MessageSetRatchetHeader(msg map[string]interface{}, header *RatchetHeader) {
+	if header == nil {
+		delete(msg, "ratchet")
+		delete(msg, "chain_idx")
+	} else {
+		msg["ratchet"] = header.Ratchet
+		msg["chain_idx"] = header.ChainIndex
+	}
+}
+
+/**
+ *  Ratchet header bound to the signature and AAD
+ *
+ *      "\n{ratchet}\n{chain_idx}"
+ *
+ * @return nil when no ratchet header
+ */
+func MessageRatchetAAD(msg map[string]interface{}) []byte {
+	header := MessageGetRatchetHeader(msg)
+	if header == nil {
+		return nil
+	}
+	return []byte("\n" + header.Ratchet + "\n" + strconv.FormatUint(header.ChainIndex, 10))
+}
+
+/**
+ *  Buffered Data Decoder
+ *  ~~~~~~~~~~~~~~~~~~~~~
+ *  Optional interface for message delegate, decodes 'message.data',
+ *  'message.key' and 'message.signature' into reusable buffers
+ *  to cut GC pressure.
+ *
+ *  The buffers are taken from a pool and belong to the message object,
+ *  they are released when Decrypt()/Verify() finishes, or when
+ *  'message.Wipe()' is called, after that the buffers will be reused
+ *  by other messages, so DON'T keep the decoded data.
+ */
+type BufferedDataDecoder interface {
+
+	/**
+	 *  Decode 'message.data' into buffer
+	 *
+	 * @param buffer - empty buffer with capacity, append decoded data to it
+	 * @param data   - base64 string object
+	 * @param sMsg   - secure message object
+	 * @return encrypted content data
+	 */
+	DecodeDataInto(buffer []byte, data interface{}, sMsg SecureMessage) []byte
+
+	/**
+	 *  Decode 'message.key' (or the receiver's one in 'keys') into buffer
+	 *
+	 * @param buffer - empty buffer with capacity, append decoded key to it
+	 * @param key    - base64 string object
+	 * @param sMsg   - secure message object
+	 * @return encrypted symmetric key data
+	 */
+	DecodeKeyInto(buffer []byte, key interface{}, sMsg SecureMessage) []byte
+
+	/**
+	 *  Decode 'message.signature' into buffer
+	 *
+	 * @param buffer    - empty buffer with capacity, append decoded signature to it
+	 * @param signature - base64 string object
+	 * @param rMsg      - reliable message object
+	 * @return signature data
+	 */
+	DecodeSignatureInto(buffer []byte, signature interface{}, rMsg ReliableMessage) []byte
+}
+
 /**
  *  Reliable Message Delegate
  *  ~~~~~~~~~~~~~~~~~~~~~~~~~
@@ -0,0 +1,106 @@
+/* license: https://mit-license.org
+ *
+ *  Dao-Ke-Dao: Universal Message Module
+ *
+ *                                Written in 2022 by Moky <albert.moky@gmail.com>
+ *
+ * ==============================================================================
+ * The MIT License (MIT)
+ *
+ * Copyright (c) 2022 Albert Moky
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ * ==============================================================================
+ */
+package protocol
+
+/**
+ *  Moderation Verdict
+ *  ~~~~~~~~~~~~~~~~~~
+ *  Result of checking media hashes against a denylist
+ */
+type Verdict struct {
+	Decision  Decision  // ALLOW, REJECT or QUARANTINE
+	Algorithm string    // hash algorithm, e.g.: "sha256", "pdq"
+	Hash      string    // matched hash (hex)
+	List      string    // name of the denylist matched
+	Reason    string
+}
+
+/**
+ *  Moderation Hook
+ *  ~~~~~~~~~~~~~~~
+ *  Checks media attachments of the content while it's in plaintext:
+ *  before encryption on the sender, after decryption on the receiver.
+ *
+ *  A content with REJECT/QUARANTINE verdict is not encrypted (Encrypt
+ *  returns nil) or not delivered (Decrypt returns nil); the hook should
+ *  record the verdict for the operator.
+ */
+type ModerationHook interface {
+
+	/**
+	 *  Check content
+	 *
+	 * @param content  - message content (plaintext)
+	 * @param env      - message envelope
+	 * @param outgoing - true on sender, false on receiver
+	 * @return nil for no media or not matched
+	 */
+	Moderate(content Content, env Envelope, outgoing bool) *Verdict
+}
+
+//
+//  Instance of ModerationHook
+//
+var moderationHook ModerationHook = nil
+
+func ModerationHookSet(hook ModerationHook) {
+	moderationHook = hook
+}
+
+func ModerationHookGet() ModerationHook {
+	return moderationHook
+}
+
+/**
+ *  Check content with the moderation hook
+ *
+ * @return ALLOW when no hook or no verdict
+ */
+func ContentModerate(content Content, env Envelope, outgoing bool) Decision {
+	verdict := ContentModerateVerdict(content, env, outgoing)
+	if verdict == nil {
+		return ALLOW
+	}
+	return verdict.Decision
+}
+
+/**
+ *  Check content with the moderation hook
+ *
+ * @return nil when no hook or no verdict
+ */
+func ContentModerateVerdict(content Content, env Envelope, outgoing bool) *Verdict {
+	hook := ModerationHookGet()
+	if hook == nil {
+		return nil
+	}
+	return hook.Moderate(content, env, outgoing)
+}
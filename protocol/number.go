@@ -0,0 +1,95 @@
+/* license: https://mit-license.org
+ *
+ *  Dao-Ke-Dao: Universal Message Module
+ *
+ *                                Written in 2022 by Moky <albert.moky@gmail.com>
+ *
+ * ==============================================================================
+ * The MIT License (MIT)
+ *
+ * Copyright (c) 2022 Albert Moky
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ * ==============================================================================
+ */
+package protocol
+
+import (
+	"encoding/json"
+	"strconv"
+	. "github.com/dimchat/mkm-go/types"
+)
+
+/*
+ *  Numbers
+ *  ~~~~~~~
+ *  Numeric fields may be decoded as float64 (default), or as json.Number
+ *  by a number-preserving decoder, which keeps uint64 'sn' precisely.
+ */
+
+func numberToUint64(value interface{}) (uint64, bool) {
+	switch v := value.(type) {
+	case json.Number:
+		if number, err := strconv.ParseUint(string(v), 10, 64); err == nil {
+			return number, true
+		}
+		// maybe in float format: "1.0e3"
+		number, err := v.Float64()
+		return uint64(number), err == nil
+	case float64:
+		return uint64(v), true
+	case uint64:
+		return v, true
+	case int:
+		return uint64(v), true
+	case int64:
+		return uint64(v), true
+	case ContentType:
+		return uint64(v), true
+	}
+	return 0, false
+}
+
+func numberToFloat64(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case json.Number:
+		number, err := v.Float64()
+		return number, err == nil
+	case float64:
+		return v, true
+	case uint64:
+		return float64(v), true
+	case int:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	}
+	return 0, false
+}
+
+func parseTime(timestamp interface{}) Time {
+	if number, ok := timestamp.(json.Number); ok {
+		seconds, err := number.Float64()
+		if err != nil {
+			return TimeNil()
+		}
+		return TimeParse(seconds)
+	}
+	return TimeParse(timestamp)
+}
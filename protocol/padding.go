@@ -0,0 +1,125 @@
+/* license: https://mit-license.org
+ *
+ *  Dao-Ke-Dao: Universal Message Module
+ *
+ *                                Written in 2022 by Moky <albert.moky@gmail.com>
+ *
+ * ==============================================================================
+ * The MIT License (MIT)
+ *
+ * Copyright (c) 2022 Albert Moky
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ * ==============================================================================
+ */
+package protocol
+
+/**
+ *  Padding Policy
+ *  ~~~~~~~~~~~~~~
+ *  Pads the serialized content before encryption, so observers can't infer
+ *  message types from the ciphertext length.
+ *
+ *  Padding scheme is ISO/IEC 7816-4 (0x80 followed by 0x00s), so the receiver
+ *  can remove it without knowing the sender's policy; padded messages are
+ *  flagged with 'padded'.
+ */
+type PaddingPolicy interface {
+
+	/**
+	 *  Get padded size for data
+	 *
+	 * @param length - data length
+	 * @return padded length, must be greater than data length
+	 */
+	PaddedSize(length int) int
+}
+
+//
+//  Instance of PaddingPolicy
+//
+var paddingPolicy PaddingPolicy = nil
+
+func PaddingPolicySet(policy PaddingPolicy) {
+	paddingPolicy = policy
+}
+
+func PaddingPolicyGet() PaddingPolicy {
+	return paddingPolicy
+}
+
+func SecureMessageIsPadded(msg map[string]interface{}) bool {
+	flag, _ := msg["padded"].(bool)
+	return flag
+}
+
+func SecureMessageSetPadded(msg map[string]interface{}, padded bool) {
+	if padded {
+		msg["padded"] = true
+	} else {
+		delete(msg, "padded")
+	}
+}
+
+func PadData(data []byte, size int) []byte {
+	if size <= len(data) {
+		size = len(data) + 1
+	}
+	padded := make([]byte, size)
+	copy(padded, data)
+	padded[len(data)] = 0x80
+	return padded
+}
+
+// return nil when padding not found
+func UnpadData(data []byte) []byte {
+	for i := len(data) - 1; i >= 0; i-- {
+		switch data[i] {
+		case 0x00:
+			continue
+		case 0x80:
+			return data[:i]
+		default:
+			return nil
+		}
+	}
+	return nil
+}
+
+/**
+ *  Bucket Padding
+ *  ~~~~~~~~~~~~~~
+ *  Pads to the smallest bucket size that fits (sizes in ascending order),
+ *  to multiple of the largest bucket for oversize data.
+ */
+type BucketPadding []int
+
+func (buckets BucketPadding) PaddedSize(length int) int {
+	length++  // at least one byte for padding
+	for _, size := range buckets {
+		if length <= size {
+			return size
+		}
+	}
+	if len(buckets) == 0 {
+		return length
+	}
+	largest := buckets[len(buckets) - 1]
+	return (length + largest - 1) / largest * largest
+}
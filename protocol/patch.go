@@ -0,0 +1,124 @@
+/* license: https://mit-license.org
+ *
+ *  Dao-Ke-Dao: Universal Message Module
+ *
+ *                                Written in 2022 by Moky <albert.moky@gmail.com>
+ *
+ * ==============================================================================
+ * The MIT License (MIT)
+ *
+ * Copyright (c) 2022 Albert Moky
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ * ==============================================================================
+ */
+package protocol
+
+import (
+	"strconv"
+)
+
+/**
+ *  Compatibility Patcher
+ *  ~~~~~~~~~~~~~~~~~~~~~
+ *  Rewrites known historical quirks before parsing, e.g.:
+ *      'sn' as string,
+ *      'time' in milliseconds.
+ *
+ *  Patchers are invoked in order at the start of ContentParse() and
+ *  InstantMessageParse(); secure/reliable messages (and their envelopes)
+ *  are never patched, as their fields may be covered by the signature.
+ *
+ *  No patcher is installed by default, opt in with:
+ *      CompatibilityPatcherAdd(new(DefaultPatcher))
+ */
+type CompatibilityPatcher interface {
+
+	/**
+	 *  Patch message/content info
+	 *
+	 * @param kind - PatchContent or PatchInstant
+	 * @param info - info to be parsed, must not be modified (copy it before rewriting)
+	 * @return patched info
+	 */
+	Patch(kind string, info map[string]interface{}) map[string]interface{}
+}
+
+const (
+	PatchContent  = "content"
+	PatchInstant  = "instant"
+)
+
+//
+//  Instances of CompatibilityPatcher
+//
+var compatibilityPatchers = make([]CompatibilityPatcher, 0, 4)
+
+func CompatibilityPatcherAdd(patcher CompatibilityPatcher) {
+	compatibilityPatchers = append(compatibilityPatchers, patcher)
+}
+
+func CompatibilityPatchersClear() {
+	compatibilityPatchers = compatibilityPatchers[:0]
+}
+
+func applyPatches(kind string, info map[string]interface{}) map[string]interface{} {
+	for _, patcher := range compatibilityPatchers {
+		info = patcher.Patch(kind, info)
+	}
+	return info
+}
+
+/**
+ *  Default Patches
+ *  ~~~~~~~~~~~~~~~
+ *  1. 'sn' as string ("123") -> number
+ *  2. 'time' in milliseconds -> seconds
+ *
+ *  'group' is not patched here, InstantMessageReconcileGroup syncs it
+ *  into the envelope for group messages only (see there).
+ */
+type DefaultPatcher struct {}
+
+// timestamps greater than this are taken as milliseconds (year 5138 in seconds)
+const maxSecondsTime = 1e11
+
+func (patcher *DefaultPatcher) Patch(kind string, info map[string]interface{}) map[string]interface{} {
+	patched := info
+	copied := false
+	rewrite := func(key string, value interface{}) {
+		if !copied {
+			patched = copyFields(info)
+			copied = true
+		}
+		patched[key] = value
+	}
+	// 1. 'sn' as string
+	if text, ok := info["sn"].(string); ok && kind == PatchContent {
+		if sn, err := strconv.ParseUint(text, 10, 64); err == nil {
+			// keep uint64, float64 loses precision above 2^53
+			rewrite("sn", sn)
+		}
+	}
+	// 2. 'time' in milliseconds
+	if timestamp, ok := numberToFloat64(info["time"]); ok && timestamp > maxSecondsTime {
+		rewrite("time", timestamp / 1000)
+	}
+	return patched
+}
@@ -0,0 +1,83 @@
+/* license: https://mit-license.org
+ *
+ *  Dao-Ke-Dao: Universal Message Module
+ *
+ *                                Written in 2022 by Moky <albert.moky@gmail.com>
+ *
+ * ==============================================================================
+ * The MIT License (MIT)
+ *
+ * Copyright (c) 2022 Albert Moky
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ * ==============================================================================
+ */
+package protocol
+
+import (
+	. "github.com/dimchat/mkm-go/protocol"
+)
+
+/**
+ *  Key Pin Store
+ *  ~~~~~~~~~~~~~
+ *  Trust-on-first-use for the key in the visa attached by the sender;
+ *  consulted during Verify, when the key differs from the pinned one,
+ *  KeyChanged() decides instead of silently accepting the new visa.
+ */
+type KeyPinStore interface {
+
+	/**
+	 *  Get fingerprint of the pinned key
+	 *
+	 * @param sender - user ID
+	 * @return empty string for not pinned yet
+	 */
+	PinnedKey(sender ID) string
+
+	PinKey(sender ID, fingerprint string)
+
+	/**
+	 *  Key in the attached visa differs from the pinned one
+	 *
+	 * @return true to accept the new key (it will be pinned),
+	 *         false to reject the message
+	 */
+	KeyChanged(event *KeyChangedEvent) bool
+}
+
+type KeyChangedEvent struct {
+	Sender  ID
+	Pinned  string  // fingerprint of the pinned key
+	Current string  // fingerprint of the key in attached visa
+	Message ReliableMessage
+}
+
+//
+//  Instance of KeyPinStore
+//
+var keyPinStore KeyPinStore = nil
+
+func KeyPinStoreSet(store KeyPinStore) {
+	keyPinStore = store
+}
+
+func KeyPinStoreGet() KeyPinStore {
+	return keyPinStore
+}
@@ -0,0 +1,103 @@
+/* license: https://mit-license.org
+ *
+ *  Dao-Ke-Dao: Universal Message Module
+ *
+ *                                Written in 2022 by Moky <albert.moky@gmail.com>
+ *
+ * ==============================================================================
+ * The MIT License (MIT)
+ *
+ * Copyright (c) 2022 Albert Moky
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ * ==============================================================================
+ */
+package protocol
+
+import "fmt"
+
+/**
+ *  Content Policy
+ *  ~~~~~~~~~~~~~~
+ *  Decides whether a decrypted content can be delivered,
+ *  e.g.: enterprise gateways enforcing DLP rules
+ *
+ *  Decrypt returns nil when not allowed, the decision is returned
+ *  by SafeDecrypt as *PolicyError.
+ */
+type ContentPolicy interface {
+
+	/**
+	 *  Check decrypted content before delivering
+	 *
+	 * @param content - message content
+	 * @param env     - message envelope
+	 * @return ALLOW, REJECT or QUARANTINE
+	 */
+	Allow(content Content, env Envelope) Decision
+}
+
+type Decision uint8
+
+const (
+	ALLOW      Decision = 0  // deliver the message
+	REJECT     Decision = 1  // drop the message
+	QUARANTINE Decision = 2  // hold the message, the policy should keep a copy
+)
+
+func (decision Decision) String() string {
+	switch decision {
+	case ALLOW:
+		return "allow"
+	case REJECT:
+		return "reject"
+	case QUARANTINE:
+		return "quarantine"
+	default:
+		return fmt.Sprintf("decision(%d)", uint8(decision))
+	}
+}
+
+/**
+ *  Policy Error
+ *  ~~~~~~~~~~~~
+ *  Decrypted content not delivered by content policy or moderation hook,
+ *  the caller should drop (REJECT) or hold (QUARANTINE) the message
+ */
+type PolicyError struct {
+	Decision Decision  // REJECT or QUARANTINE
+	Verdict *Verdict   // moderation verdict, nil when decided by content policy
+}
+
+func (e *PolicyError) Error() string {
+	return "content not delivered, policy decision: " + e.Decision.String()
+}
+
+//
+//  Instance of ContentPolicy
+//
+var contentPolicy ContentPolicy = nil
+
+func ContentPolicySet(policy ContentPolicy) {
+	contentPolicy = policy
+}
+
+func ContentPolicyGet() ContentPolicy {
+	return contentPolicy
+}
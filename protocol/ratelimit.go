@@ -0,0 +1,71 @@
+/* license: https://mit-license.org
+ *
+ *  Dao-Ke-Dao: Universal Message Module
+ *
+ *                                Written in 2022 by Moky <albert.moky@gmail.com>
+ *
+ * ==============================================================================
+ * The MIT License (MIT)
+ *
+ * Copyright (c) 2022 Albert Moky
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ * ==============================================================================
+ */
+package protocol
+
+import (
+	. "github.com/dimchat/mkm-go/protocol"
+)
+
+/**
+ *  Rate Limiter
+ *  ~~~~~~~~~~~~
+ *  Consulted before verifying signatures, keyed by sender ID,
+ *  so a flood of forged messages from one identity can't consume
+ *  all the verification CPU.
+ *
+ *  NOTICE: Parse is not limited, the sender is unknown before parsing,
+ *          and parsing cost is already bounded by the message limits
+ *          (size, nesting, keys), so limiting there would only take
+ *          the sender's tokens twice for the same message.
+ */
+type RateLimiter interface {
+
+	/**
+	 *  Check whether the sender can take one more verification now
+	 *
+	 * @param sender - message sender
+	 * @return false to reject the message without verifying
+	 */
+	Allow(sender ID) bool
+}
+
+//
+//  Instance of RateLimiter
+//
+var rateLimiter RateLimiter = nil
+
+func RateLimiterSet(limiter RateLimiter) {
+	rateLimiter = limiter
+}
+
+func RateLimiterGet() RateLimiter {
+	return rateLimiter
+}
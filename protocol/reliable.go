@@ -31,6 +31,8 @@
 package protocol
 
 import (
+	"encoding/json"
+	"errors"
 	. "github.com/dimchat/mkm-go/protocol"
 	. "github.com/dimchat/mkm-go/types"
 )
@@ -81,6 +83,19 @@ type ReliableMessage interface {
 	Visa() Visa
 	SetVisa(visa Visa)
 
+	/**
+	 *  Attachments
+	 *  ~~~~~~~~~~~
+	 *  Other documents for the first message package of 'Handshake' protocol,
+	 *  such as station documents or login proofs.
+	 *
+	 * @param name - whitelisted name (see AttachmentSetAllowed)
+	 * @param doc  - document; nil to remove
+	 * @return ErrAttachmentNotAllowed or ErrAttachmentTooLarge
+	 */
+	Attachment(name string) map[string]interface{}
+	SetAttachment(name string, doc Mapper) error
+
 	/*
 	 *  Verify the Reliable Message to Secure Message
 	 *
@@ -101,6 +116,14 @@ type ReliableMessage interface {
 	 * @return SecureMessage object
 	 */
 	Verify() SecureMessage
+
+	/**
+	 *  Cheap sanity check of the signature decoded by the delegate (size),
+	 *  without touching the public key or crypto provider
+	 *
+	 * @return false on obviously garbage signature
+	 */
+	PlausibleSignature() bool
 }
 
 func ReliableMessageGetMeta(msg map[string]interface{}) Meta {
@@ -133,6 +156,132 @@ func ReliableMessageSetVisa(msg map[string]interface{}, visa Visa) {
 	}
 }
 
+/**
+ *  Push Preview
+ *  ~~~~~~~~~~~~
+ *  Short preview of the content encrypted by the sender for the receiver's
+ *  device (base64), opaque to stations and push gateways
+ */
+func ReliableMessageGetPreview(msg map[string]interface{}) string {
+	preview, _ := msg["preview"].(string)
+	return preview
+}
+
+func ReliableMessageSetPreview(msg map[string]interface{}, preview string) {
+	if preview == "" {
+		delete(msg, "preview")
+	} else {
+		msg["preview"] = preview
+	}
+}
+
+/**
+ *  Handshake Policy
+ *  ~~~~~~~~~~~~~~~~
+ *  Decides whether the meta/visa attached by the sender can be used,
+ *  invoked before ReliableMessage.Meta()/Visa() return them;
+ *  rejected attachments are taken as not attached.
+ */
+type HandshakePolicy interface {
+
+	AcceptMeta(meta Meta, rMsg ReliableMessage) bool
+
+	AcceptVisa(visa Visa, rMsg ReliableMessage) bool
+}
+
+//
+//  Instance of HandshakePolicy
+//
+var handshakePolicy HandshakePolicy = nil
+
+func HandshakePolicySet(policy HandshakePolicy) {
+	handshakePolicy = policy
+}
+
+func HandshakePolicyGet() HandshakePolicy {
+	return handshakePolicy
+}
+
+/**
+ *  Attachments Whitelist
+ *  ~~~~~~~~~~~~~~~~~~~~~
+ *  name => max size (bytes of JsON), 0 means no limit
+ */
+var attachmentLimits = map[string]int{
+	"meta": 0,
+	"visa": 0,
+}
+
+var ErrAttachmentNotAllowed = errors.New("attachment name not allowed")
+var ErrAttachmentTooLarge = errors.New("attachment too large")
+
+func AttachmentSetAllowed(name string, maxSize int) {
+	attachmentLimits[name] = maxSize
+}
+
+func AttachmentRemoveAllowed(name string) {
+	delete(attachmentLimits, name)
+}
+
+func ReliableMessageGetAttachment(msg map[string]interface{}, name string) map[string]interface{} {
+	if _, ok := attachmentLimits[name]; !ok {
+		return nil
+	}
+	doc, _ := msg[name].(map[string]interface{})
+	return doc
+}
+
+func ReliableMessageSetAttachment(msg map[string]interface{}, name string, doc Mapper) error {
+	maxSize, ok := attachmentLimits[name]
+	if !ok {
+		return ErrAttachmentNotAllowed
+	}
+	if ValueIsNil(doc) {
+		delete(msg, name)
+		return nil
+	}
+	if maxSize > 0 {
+		data, err := json.Marshal(doc.Map())
+		if err != nil {
+			return err
+		}
+		if len(data) > maxSize {
+			return ErrAttachmentTooLarge
+		}
+	}
+	msg[name] = doc.Map()
+	return nil
+}
+
+/**
+ *  Attachment Policy
+ *  ~~~~~~~~~~~~~~~~~
+ *  Consulted after the secure message signed,
+ *  decides which documents (meta/visa/...) should be attached.
+ */
+type AttachmentPolicy interface {
+
+	/**
+	 *  Attach documents to the message
+	 *
+	 * @param rMsg - message just signed
+	 */
+	Attach(rMsg ReliableMessage)
+}
+
+//
+//  Instance of AttachmentPolicy
+//
+var attachmentPolicy AttachmentPolicy = nil
+
+func AttachmentPolicySet(policy AttachmentPolicy) {
+	attachmentPolicy = policy
+}
+
+func AttachmentPolicyGet() AttachmentPolicy {
+	return attachmentPolicy
+}
+
 /**
  *  Message Factory
  *  ~~~~~~~~~~~~~~~
@@ -153,6 +302,7 @@ type ReliableMessageFactory interface {
 //
 var reliableFactory ReliableMessageFactory = nil
 
+// replace the current factory
 func ReliableMessageSetFactory(factory ReliableMessageFactory) {
 	reliableFactory = factory
 }
@@ -165,15 +315,23 @@ func ReliableMessageGetFactory() ReliableMessageFactory {
 //  Factory method
 //
 func ReliableMessageParse(msg interface{}) ReliableMessage {
+	value, _ := ReliableMessageParseE(msg)
+	return value
+}
+
+func ReliableMessageParseE(msg interface{}) (ReliableMessage, error) {
 	if ValueIsNil(msg) {
-		return nil
+		return nil, nil
 	}
 	value, ok := msg.(ReliableMessage)
 	if ok {
-		return value
+		return value, nil
 	}
 	info := FetchMap(msg)
+	if err := requireFactory("reliable message", func() bool { return reliableFactory != nil }); err != nil {
+		return nil, err
+	}
 	// create by message factory
 	factory := ReliableMessageGetFactory()
-	return factory.ParseReliableMessage(info)
+	return factory.ParseReliableMessage(info), nil
 }
@@ -0,0 +1,75 @@
+/* license: https://mit-license.org
+ *
+ *  Dao-Ke-Dao: Universal Message Module
+ *
+ *                                Written in 2022 by Moky <albert.moky@gmail.com>
+ *
+ * ==============================================================================
+ * The MIT License (MIT)
+ *
+ * Copyright (c) 2022 Albert Moky
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ * ==============================================================================
+ */
+package protocol
+
+import (
+	. "github.com/dimchat/mkm-go/protocol"
+	. "github.com/dimchat/mkm-go/types"
+)
+
+/**
+ *  ID Resolver
+ *  ~~~~~~~~~~~
+ *  Resolves short IDs, DNS-like aliases or DID URIs in envelopes
+ *  to canonical IDs, used by EnvelopeGetSender/Receiver/Group.
+ */
+type IDResolver interface {
+
+	/**
+	 *  Resolve identifier to canonical ID
+	 *
+	 * @param identifier - value of 'sender'/'receiver'/'group'
+	 * @return nil to parse it as a normal ID
+	 */
+	ResolveID(identifier interface{}) ID
+}
+
+//
+//  Instance of IDResolver
+//
+var idResolver IDResolver = nil
+
+func IDResolverSet(resolver IDResolver) {
+	idResolver = resolver
+}
+
+func IDResolverGet() IDResolver {
+	return idResolver
+}
+
+func resolveID(identifier interface{}) ID {
+	if idResolver != nil && !ValueIsNil(identifier) {
+		if id := idResolver.ResolveID(identifier); id != nil {
+			return id
+		}
+	}
+	return IDParse(identifier)
+}
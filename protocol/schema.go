@@ -0,0 +1,180 @@
+/* license: https://mit-license.org
+ *
+ *  Dao-Ke-Dao: Universal Message Module
+ *
+ *                                Written in 2022 by Moky <albert.moky@gmail.com>
+ *
+ * ==============================================================================
+ * The MIT License (MIT)
+ *
+ * Copyright (c) 2022 Albert Moky
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ * ==============================================================================
+ */
+package protocol
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+/**
+ *  Content Schema
+ *  ~~~~~~~~~~~~~~
+ *  Content factory can declare the fields of its content,
+ *  which will be checked in ContentParse() when strict mode is on.
+ *
+ *  e.g.: ContentSchema{
+ *      {Name: "text", Kind: FieldString, Required: true},
+ *      {Name: "URL",  Kind: FieldURL},
+ *  }
+ */
+type ContentSchemaDeclarer interface {
+	ContentSchema() ContentSchema
+}
+
+type ContentSchema []FieldRule
+
+type FieldRule struct {
+	Name     string
+	Kind     FieldKind
+	Required bool
+}
+
+type FieldKind uint8
+
+const (
+	FieldAny    FieldKind = 0
+	FieldString FieldKind = 1
+	FieldNumber FieldKind = 2
+	FieldBool   FieldKind = 3
+	FieldMap    FieldKind = 4
+	FieldList   FieldKind = 5
+	FieldURL    FieldKind = 6  // string with scheme
+)
+
+/**
+ *  Validation Error
+ *  ~~~~~~~~~~~~~~~~
+ *  All problems found in one content
+ */
+type ValidationError struct {
+	Type     ContentType
+	Problems []string
+}
+
+func (err *ValidationError) Error() string {
+	return fmt.Sprintf("invalid content %s: %s", err.Type, strings.Join(err.Problems, "; "))
+}
+
+//
+//  Strict mode
+//
+var contentStrict = false
+
+func ContentSetStrict(strict bool) {
+	contentStrict = strict
+}
+
+func ContentIsStrict() bool {
+	return contentStrict
+}
+
+/**
+ *  Validate content with the schema declared by its factory
+ *
+ * @param content - content info
+ * @return *ValidationError; nil when valid or no schema declared
+ */
+func ContentValidate(content map[string]interface{}) error {
+	msgType := ContentGetType(content)
+	declarer, ok := ContentGetFactory(msgType).(ContentSchemaDeclarer)
+	if !ok {
+		return nil
+	}
+	problems := make([]string, 0)
+	for _, rule := range declarer.ContentSchema() {
+		value, exists := content[rule.Name]
+		if !exists || value == nil {
+			if rule.Required {
+				problems = append(problems, fmt.Sprintf("'%s' required", rule.Name))
+			}
+			continue
+		}
+		if !fieldMatch(rule.Kind, value) {
+			problems = append(problems, fmt.Sprintf("'%s' should be %s", rule.Name, rule.Kind))
+		}
+	}
+	if len(problems) > 0 {
+		return &ValidationError{Type: msgType, Problems: problems}
+	}
+	return nil
+}
+
+func fieldMatch(kind FieldKind, value interface{}) bool {
+	switch kind {
+	case FieldString:
+		_, ok := value.(string)
+		return ok
+	case FieldNumber:
+		switch value.(type) {
+		case float64, float32, int, int64, int32, uint, uint64, uint32, uint8, json.Number:
+			return true
+		}
+		return false
+	case FieldBool:
+		_, ok := value.(bool)
+		return ok
+	case FieldMap:
+		_, ok := value.(map[string]interface{})
+		return ok
+	case FieldList:
+		_, ok := value.([]interface{})
+		return ok
+	case FieldURL:
+		str, ok := value.(string)
+		if !ok {
+			return false
+		}
+		u, err := url.Parse(str)
+		return err == nil && u.Scheme != ""
+	}
+	return true
+}
+
+func (kind FieldKind) String() string {
+	switch kind {
+	case FieldString:
+		return "string"
+	case FieldNumber:
+		return "number"
+	case FieldBool:
+		return "bool"
+	case FieldMap:
+		return "map"
+	case FieldList:
+		return "list"
+	case FieldURL:
+		return "URL"
+	}
+	return "any"
+}
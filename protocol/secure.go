@@ -31,6 +31,8 @@
 package protocol
 
 import (
+	"context"
+	"errors"
 	. "github.com/dimchat/mkm-go/protocol"
 	. "github.com/dimchat/mkm-go/types"
 )
@@ -50,7 +52,8 @@ import (
  *      key      : "...",  // base64_encode(asymmetric)
  *      keys     : {
  *          "ID1": "key1", // base64_encode(asymmetric)
- *      }
+ *      },
+ *      key_digest : "..." // digest of reused key, OPTIONAL
  *  }
  */
 type SecureMessage interface {
@@ -60,6 +63,17 @@ type SecureMessage interface {
 	EncryptedKey() []byte
 	EncryptedKeys() map[string]string
 
+	/**
+	 *  Digest of the reused key, which was distributed before,
+	 *  so 'key'/'keys' can be omitted
+	 */
+	KeyDigest() string
+
+	/**
+	 *  Zero the cached key & data buffers after processing
+	 */
+	Wipe()
+
 	/*
 	 *  Decrypt the Secure Message to Instant Message
 	 *
@@ -80,6 +94,22 @@ type SecureMessage interface {
 	 */
 	Decrypt() InstantMessage
 
+	/**
+	 *  Decrypt message into the given map (cleared first) for callers
+	 *  managing their own buffers; the source message keeps untouched
+	 *
+	 * @param dst - map to hold the instant message; nil to create a new one
+	 * @return InstantMessage object
+	 */
+	DecryptInto(dst map[string]interface{}) InstantMessage
+
+	/**
+	 *  Decrypt message, await AsyncDelegate for the key until ctx done
+	 *
+	 * @return InstantMessage object
+	 */
+	DecryptContext(ctx context.Context) InstantMessage
+
 	/*
 	 *  Sign the Secure Message to Reliable Message
 	 *
@@ -101,6 +131,13 @@ type SecureMessage interface {
 	 */
 	Sign() ReliableMessage
 
+	/**
+	 *  Sign message, await AsyncDelegate for the signature until ctx done
+	 *
+	 * @return ReliableMessage object
+	 */
+	SignContext(ctx context.Context) ReliableMessage
+
 	/*
 	 *  Split/Trim group message
 	 *
@@ -115,6 +152,25 @@ type SecureMessage interface {
 	 */
 	Split(members []ID) []SecureMessage
 
+	/**
+	 *  Split the group message to single person messages,
+	 *  ask the provider for keys of members not in 'keys'
+	 *
+	 *  @param members  - group members
+	 *  @param provider - key provider for missing members
+	 *  @return secure/reliable message(s)
+	 */
+	SplitWithKeyProvider(members []ID, provider KeyProvider) []SecureMessage
+
+	/**
+	 *  Split the group message to single person messages with options
+	 *
+	 *  @param members - group members
+	 *  @param options - split options
+	 *  @return secure/reliable message(s)
+	 */
+	SplitWithOptions(members []ID, options *SplitOptions) []SecureMessage
+
 	/**
 	 *  Trim the group message for a member
 	 *
@@ -122,8 +178,117 @@ type SecureMessage interface {
 	 * @return SecureMessage
 	 */
 	Trim(member ID) SecureMessage
+
+	/**
+	 *  Trim the group message for a member,
+	 *  fail if the member's key not found in 'keys'
+	 *
+	 * @param member - group member ID/string
+	 * @return SecureMessage, or ErrMemberKeyNotFound
+	 */
+	TrimE(member ID) (SecureMessage, error)
+
+	/**
+	 *  Trim the group message for a member,
+	 *  fall back to the group-shared 'key' when member's key not found
+	 *
+	 * @param member - group member ID/string
+	 * @return SecureMessage, or ErrMemberKeyNotFound
+	 */
+	TrimWithSharedKey(member ID) (SecureMessage, error)
+}
+
+func SecureMessageGetKeyDigest(msg map[string]interface{}) string {
+	digest, _ := msg["key_digest"].(string)
+	return digest
+}
+
+func SecureMessageSetKeyDigest(msg map[string]interface{}, digest string) {
+	if digest == "" {
+		delete(msg, "key_digest")
+	} else {
+		msg["key_digest"] = digest
+	}
+}
+
+/**
+ *  Content Cipher
+ *  ~~~~~~~~~~~~~~
+ *  name of the algorithm encrypted 'data', e.g.: "AES-256-GCM";
+ *  empty for the default of the symmetric key
+ */
+func SecureMessageGetCipher(msg map[string]interface{}) string {
+	cipher, _ := msg["cipher"].(string)
+	return cipher
+}
+
+func SecureMessageSetCipher(msg map[string]interface{}, cipher string) {
+	if cipher == "" {
+		delete(msg, "cipher")
+	} else {
+		msg["cipher"] = cipher
+	}
+}
+
+/**
+ *  Plaintext Message
+ *  ~~~~~~~~~~~~~~~~~
+ *  For public channels/broadcasts, the content is only encoded, not encrypted,
+ *  and the message is flagged with 'plaintext';
+ *  the flag is kept in the decoded instant message too
+ */
+func SecureMessageIsPlaintext(msg map[string]interface{}) bool {
+	flag, _ := msg["plaintext"].(bool)
+	return flag
+}
+
+func SecureMessageSetPlaintext(msg map[string]interface{}, plaintext bool) {
+	if plaintext {
+		msg["plaintext"] = true
+	} else {
+		delete(msg, "plaintext")
+	}
+}
+
+/**
+ *  Key Provider
+ *  ~~~~~~~~~~~~
+ *  Supplies encrypted keys for group members who are not in 'keys',
+ *  e.g.: members added after the message was encrypted
+ */
+type KeyProvider interface {
+
+	/**
+	 *  Get encrypted key for the member
+	 *
+	 * @param member - group member ID
+	 * @param sMsg   - group message
+	 * @return base64 string of encrypted key; empty string if not available
+	 */
+	ProvideKey(member ID, sMsg SecureMessage) string
+}
+
+/**
+ *  Split Options
+ *  ~~~~~~~~~~~~~
+ */
+type SplitOptions struct {
+
+	// don't move the receiver(group ID) to 'group',
+	// so the others won't know your membership;
+	// not for messages with AAD, which binds the group ID
+	HideGroup bool
+
+	// keep the 'traces' field in split messages
+	IncludeTraces bool
+
+	// supplies keys for members not in 'keys', optional
+	KeyProvider KeyProvider
 }
 
+var ErrMemberKeyNotFound = errors.New("member key not found in 'keys'")
+var ErrHideGroupWithAAD = errors.New("cannot hide group of message with AAD")
+
 /**
  *  Message Factory
  *  ~~~~~~~~~~~~~~~
@@ -144,6 +309,7 @@ type SecureMessageFactory interface {
 //
 var secureFactory SecureMessageFactory = nil
 
+// replace the current factory
 func SecureMessageSetFactory(factory SecureMessageFactory) {
 	secureFactory = factory
 }
@@ -156,15 +322,23 @@ func SecureMessageGetFactory() SecureMessageFactory {
 //  Factory method
 //
 func SecureMessageParse(msg interface{}) SecureMessage {
+	value, _ := SecureMessageParseE(msg)
+	return value
+}
+
+func SecureMessageParseE(msg interface{}) (SecureMessage, error) {
 	if ValueIsNil(msg) {
-		return nil
+		return nil, nil
 	}
 	value, ok := msg.(SecureMessage)
 	if ok {
-		return value
+		return value, nil
 	}
 	info := FetchMap(msg)
+	if err := requireFactory("secure message", func() bool { return secureFactory != nil }); err != nil {
+		return nil, err
+	}
 	// create by message factory
 	factory := SecureMessageGetFactory()
-	return factory.ParseSecureMessage(info)
+	return factory.ParseSecureMessage(info), nil
 }
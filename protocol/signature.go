@@ -0,0 +1,146 @@
+/* license: https://mit-license.org
+ *
+ *  Dao-Ke-Dao: Universal Message Module
+ *
+ *                                Written in 2022 by Moky <albert.moky@gmail.com>
+ *
+ * ==============================================================================
+ * The MIT License (MIT)
+ *
+ * Copyright (c) 2022 Albert Moky
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ * ==============================================================================
+ */
+package protocol
+
+import (
+	. "github.com/dimchat/mkm-go/crypto"
+)
+
+/**
+ *  Signature Rule
+ *  ~~~~~~~~~~~~~~
+ *  Size range of the decoded signature for an algorithm,
+ *  used to reject garbage messages before verifying.
+ */
+type SignatureRule struct {
+	MinSize int
+	MaxSize int
+}
+
+// rule for unknown algorithm
+var anySignature = SignatureRule{MinSize: 32, MaxSize: 1024}
+
+//
+//  Instances of SignatureRule
+//
+var signatureRules = map[string]SignatureRule{
+	ECC: {MinSize: 64, MaxSize: 72},   // secp256k1, raw (r|s) or DER
+	RSA: {MinSize: 128, MaxSize: 512}, // 1024 ~ 4096 bits
+}
+
+func SignatureRuleSet(algorithm string, rule SignatureRule) {
+	signatureRules[algorithm] = rule
+}
+
+func SignatureRuleGet(algorithm string) SignatureRule {
+	rule, ok := signatureRules[algorithm]
+	if !ok {
+		return anySignature
+	}
+	return rule
+}
+
+/**
+ *  Cheap check for the 'signature' field, without decoding or verifying:
+ *  it must be a base64 string, with a decoded size in the range for the
+ *  algorithm of the sender's key (taken from the attached meta),
+ *  or the generic range if meta not attached.
+ *
+ *  NOTICE: this assumes the default (base64) encoding, for messages with
+ *          a delegate, check the decoded bytes by SignaturePlausible().
+ *
+ * @param msg - reliable message info
+ * @return false on obviously garbage signature
+ */
+func ReliableMessagePlausibleSignature(msg map[string]interface{}) bool {
+	signature, ok := msg["signature"].(string)
+	if !ok {
+		return false
+	}
+	size := base64Size(signature)
+	if size < 0 {
+		return false
+	}
+	return signatureRuleFor(msg).contains(size)
+}
+
+/**
+ *  Cheap check for the signature decoded by the message delegate,
+ *  its size must be in the range for the algorithm of the sender's key
+ *
+ * @param signature - decoded signature
+ * @param msg       - reliable message info
+ * @return false on obviously garbage signature
+ */
+func SignaturePlausible(signature []byte, msg map[string]interface{}) bool {
+	if signature == nil {
+		return false
+	}
+	return signatureRuleFor(msg).contains(len(signature))
+}
+
+func (rule SignatureRule) contains(size int) bool {
+	return rule.MinSize <= size && size <= rule.MaxSize
+}
+
+// rule for the algorithm of the attached meta key
+func signatureRuleFor(msg map[string]interface{}) SignatureRule {
+	rule := anySignature
+	if meta, ok := msg["meta"].(map[string]interface{}); ok {
+		if key, ok := meta["key"].(map[string]interface{}); ok {
+			if algorithm, ok := key["algorithm"].(string); ok {
+				rule = SignatureRuleGet(algorithm)
+			}
+		}
+	}
+	return rule
+}
+
+// decoded size of standard/url-safe base64 string, -1 on invalid characters
+func base64Size(text string) int {
+	length := len(text)
+	padding := 0
+	for length > 0 && text[length - 1] == '=' {
+		length--
+		padding++
+	}
+	if padding > 2 {
+		return -1
+	}
+	for i := 0; i < length; i++ {
+		c := text[i]
+		if !('A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' ||
+			c == '+' || c == '/' || c == '-' || c == '_') {
+			return -1
+		}
+	}
+	return length * 6 / 8
+}
@@ -0,0 +1,136 @@
+/* license: https://mit-license.org
+ *
+ *  Dao-Ke-Dao: Universal Message Module
+ *
+ *                                Written in 2022 by Moky <albert.moky@gmail.com>
+ *
+ * ==============================================================================
+ * The MIT License (MIT)
+ *
+ * Copyright (c) 2022 Albert Moky
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ * ==============================================================================
+ */
+package protocol
+
+import (
+	"fmt"
+	. "github.com/dimchat/mkm-go/protocol"
+)
+
+/**
+ *  Thread
+ *  ~~~~~~
+ *  Reply in thread for forum-style group chat
+ *
+ *  data format: {
+ *      //...
+ *      'thread' : {
+ *          'sn'     : 123,        // serial number of the root message
+ *          'sender' : "moki@xxx"  // sender of the root message
+ *      }
+ *  }
+ */
+type Thread struct {
+	SN     uint64
+	Sender ID
+}
+
+func (thread *Thread) String() string {
+	return fmt.Sprintf("%s#%d", thread.Sender, thread.SN)
+}
+
+func ContentGetThread(content map[string]interface{}) *Thread {
+	info, ok := content["thread"].(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	sender := IDParse(info["sender"])
+	if sender == nil {
+		return nil
+	}
+	return &Thread{SN: ContentGetSN(info), Sender: sender}
+}
+
+func ContentSetThread(content map[string]interface{}, thread *Thread) {
+	if thread == nil {
+		delete(content, "thread")
+	} else {
+		content["thread"] = map[string]interface{}{
+			"sn":     thread.SN,
+			"sender": thread.Sender.String(),
+		}
+	}
+}
+
+/**
+ *  Get the thread which the message belongs to,
+ *  a message not in any thread is the root of its own thread
+ */
+func MessageGetThread(iMsg InstantMessage) *Thread {
+	content := iMsg.Content()
+	thread := ContentGetThread(content.Map())
+	if thread == nil {
+		thread = &Thread{SN: content.SN(), Sender: iMsg.Sender()}
+	}
+	return thread
+}
+
+/**
+ *  Make content a reply in the thread of the message
+ *
+ * @param content - reply content
+ * @param iMsg    - message to reply
+ */
+func ContentReplyInThread(content Content, iMsg InstantMessage) {
+	ContentSetThread(content.Map(), MessageGetThread(iMsg))
+}
+
+/**
+ *  Messages in Thread
+ *  ~~~~~~~~~~~~~~~~~~
+ */
+type ThreadMessages struct {
+	Root     *Thread
+	Messages []InstantMessage
+}
+
+/**
+ *  Group messages into threads
+ *
+ * @param messages - message list
+ * @return threads in order of first appearance, messages keep their order
+ */
+func GroupByThread(messages []InstantMessage) []*ThreadMessages {
+	threads := make([]*ThreadMessages, 0)
+	index := make(map[string]*ThreadMessages)
+	for _, iMsg := range messages {
+		root := MessageGetThread(iMsg)
+		key := root.String()
+		item := index[key]
+		if item == nil {
+			item = &ThreadMessages{Root: root}
+			index[key] = item
+			threads = append(threads, item)
+		}
+		item.Messages = append(item.Messages, iMsg)
+	}
+	return threads
+}
@@ -0,0 +1,153 @@
+/* license: https://mit-license.org
+ *
+ *  Dao-Ke-Dao: Universal Message Module
+ *
+ *                                Written in 2022 by Moky <albert.moky@gmail.com>
+ *
+ * ==============================================================================
+ * The MIT License (MIT)
+ *
+ * Copyright (c) 2022 Albert Moky
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ * ==============================================================================
+ */
+package protocol
+
+import (
+	"strconv"
+	"strings"
+)
+
+/**
+ *  Content Transcoder
+ *  ~~~~~~~~~~~~~~~~~~
+ *  Converts content 'type' between the legacy numeric form (this SDK)
+ *  and the string-based form used by newer DIM SDKs.
+ *
+ *  Incoming contents are imported in ContentParse(); outgoing contents
+ *  should be exported by the delegate before serializing, with the version
+ *  hint of the peer.
+ */
+type ContentTranscoder interface {
+
+	/**
+	 *  Convert received content into the local form
+	 *
+	 * @param content - content info, must not be modified
+	 * @return content info with numeric 'type'
+	 */
+	Import(content map[string]interface{}) map[string]interface{}
+
+	/**
+	 *  Convert content into the form the peer understands
+	 *
+	 * @param content     - content info, must not be modified
+	 * @param peerVersion - TypeVersionNumeric or TypeVersionString
+	 * @return content info
+	 */
+	Export(content map[string]interface{}, peerVersion int) map[string]interface{}
+}
+
+const (
+	TypeVersionNumeric = 1  // 'type' as number, e.g.: 0x01
+	TypeVersionString  = 2  // 'type' as string, e.g.: "text"
+)
+
+//
+//  Instance of ContentTranscoder
+//
+var contentTranscoder ContentTranscoder = nil
+
+func ContentTranscoderSet(transcoder ContentTranscoder) {
+	contentTranscoder = transcoder
+}
+
+func ContentTranscoderGet() ContentTranscoder {
+	return contentTranscoder
+}
+
+/**
+ *  Export content for peer with the current transcoder
+ */
+func ContentExport(content map[string]interface{}, peerVersion int) map[string]interface{} {
+	transcoder := ContentTranscoderGet()
+	if transcoder == nil {
+		return content
+	}
+	return transcoder.Export(content, peerVersion)
+}
+
+/**
+ *  Get content type from string, which can be an alias (case insensitive),
+ *  or a number in decimal/hexadecimal ("0x88")
+ *
+ * @return 0 on not found
+ */
+func ContentTypeFromString(text string) ContentType {
+	if value, err := strconv.ParseUint(text, 0, 8); err == nil {
+		return ContentType(value)
+	}
+	for msgType, alias := range msgTypeNames {
+		if strings.EqualFold(alias, text) {
+			return msgType
+		}
+	}
+	return 0
+}
+
+/**
+ *  Alias Transcoder
+ *  ~~~~~~~~~~~~~~~~
+ *  Maps numeric types to the lower case aliases (ContentTypeSetAlias)
+ */
+type AliasTranscoder struct {}
+
+func (transcoder *AliasTranscoder) Import(content map[string]interface{}) map[string]interface{} {
+	text, ok := content["type"].(string)
+	if !ok {
+		return content
+	}
+	info := copyFields(content)
+	info["type"] = ContentTypeFromString(text)
+	return info
+}
+
+func (transcoder *AliasTranscoder) Export(content map[string]interface{}, peerVersion int) map[string]interface{} {
+	if peerVersion < TypeVersionString {
+		return transcoder.Import(content)
+	}
+	msgType := ContentGetType(content)
+	alias := ContentTypeGetAlias(msgType)
+	if alias == "" {
+		// no alias, keep the number as string
+		alias = strconv.Itoa(int(msgType))
+	}
+	info := copyFields(content)
+	info["type"] = strings.ToLower(alias)
+	return info
+}
+
+func copyFields(content map[string]interface{}) map[string]interface{} {
+	info := make(map[string]interface{}, len(content))
+	for key, value := range content {
+		info[key] = value
+	}
+	return info
+}